@@ -0,0 +1,205 @@
+package ex
+
+/*
+ * 访问日志，支持Apache common/combined格式，JSON行以及自定义模板
+ */
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// 预定义的访问日志格式，其他值会作为text/template模板解析，字段见AccessLogEntry
+const (
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// 访问日志配置
+type AccessLogConfig struct {
+	// 日志格式，默认为combined
+	Format string
+	// 输出位置，默认为os.Stdout，可以使用RotatingFile
+	Output io.Writer
+	// 不记录日志的路径
+	SkipPaths []string
+}
+
+// 一条访问日志，自定义模板中可以使用这些字段，例如{{.Method}} {{.Path}} {{.Latency}}
+type AccessLogEntry struct {
+	Time      time.Time     `json:"time"`
+	RemoteIP  string        `json:"remote_ip"`
+	User      string        `json:"user,omitempty"`
+	Method    string        `json:"method"`
+	Host      string        `json:"host"`
+	Path      string        `json:"path"`
+	URI       string        `json:"uri"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+	Latency   time.Duration `json:"latency"`
+}
+
+// 访问日志中间件，自定义模板解析失败时panic，需要处理错误时使用NewAccessLog
+func AccessLog(config AccessLogConfig) HandlerFunc {
+	handler, err := NewAccessLog(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
+
+// 创建访问日志中间件，自定义模板解析失败时返回错误
+func NewAccessLog(config AccessLogConfig) (HandlerFunc, error) {
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	if config.Format == "" {
+		config.Format = AccessLogCombined
+	}
+
+	var format func(buf *bytes.Buffer, entry *AccessLogEntry, codec JSONCodec) error
+	switch config.Format {
+	case AccessLogCommon:
+		format = func(buf *bytes.Buffer, entry *AccessLogEntry, codec JSONCodec) error {
+			writeCommonLog(buf, entry)
+			return nil
+		}
+	case AccessLogCombined:
+		format = func(buf *bytes.Buffer, entry *AccessLogEntry, codec JSONCodec) error {
+			writeCommonLog(buf, entry)
+			buf.WriteString(` "`)
+			buf.WriteString(escapeLogField(entry.Referer))
+			buf.WriteString(`" "`)
+			buf.WriteString(escapeLogField(entry.UserAgent))
+			buf.WriteByte('"')
+			return nil
+		}
+	case AccessLogJSON:
+		format = func(buf *bytes.Buffer, entry *AccessLogEntry, codec JSONCodec) error {
+			b, err := codec.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			buf.Write(b)
+			return nil
+		}
+	default:
+		tmpl, err := template.New("access_log").Parse(config.Format)
+		if err != nil {
+			return nil, fmt.Errorf("ex: invalid access log format: %w", err)
+		}
+		format = func(buf *bytes.Buffer, entry *AccessLogEntry, codec JSONCodec) error {
+			return tmpl.Execute(buf, entry)
+		}
+	}
+
+	skip := make(map[string]bool, len(config.SkipPaths))
+	for _, path := range config.SkipPaths {
+		skip[path] = true
+	}
+	var mu sync.Mutex
+
+	return func(ctx *Context) {
+		if skip[ctx.Path] {
+			ctx.Next()
+			return
+		}
+
+		start := time.Now()
+		path := ctx.Req.URL.Path
+		uri := ctx.Req.RequestURI
+		if uri == "" {
+			uri = ctx.Req.URL.RequestURI()
+		}
+		ctx.Next()
+
+		entry := &AccessLogEntry{
+			Time:      start,
+			RemoteIP:  ctx.RealIP(),
+			Method:    ctx.Method,
+			Host:      ctx.Req.Host,
+			Path:      path,
+			URI:       uri,
+			Proto:     ctx.Req.Proto,
+			Status:    ctx.StatusCode,
+			Bytes:     ctx.ResponseSize(),
+			Referer:   ctx.Req.Referer(),
+			UserAgent: ctx.Req.UserAgent(),
+			RequestID: ctx.RequestID(),
+			Latency:   time.Since(start),
+		}
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		if user, _, ok := ctx.Req.BasicAuth(); ok {
+			entry.User = user
+		}
+
+		var buf bytes.Buffer
+		if err := format(&buf, entry, ctx.JSONCodec()); err != nil {
+			return
+		}
+		buf.WriteByte('\n')
+		mu.Lock()
+		config.Output.Write(buf.Bytes())
+		mu.Unlock()
+	}, nil
+}
+
+// Apache common格式: host ident user [time] "request" status bytes
+func writeCommonLog(buf *bytes.Buffer, entry *AccessLogEntry) {
+	user := entry.User
+	if user == "" {
+		user = "-"
+	}
+	buf.WriteString(entry.RemoteIP)
+	buf.WriteString(" - ")
+	buf.WriteString(escapeLogField(user))
+	buf.WriteString(" [")
+	buf.WriteString(entry.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	buf.WriteString(`] "`)
+	buf.WriteString(escapeLogField(entry.Method + " " + entry.URI + " " + entry.Proto))
+	buf.WriteString(`" `)
+	buf.WriteString(strconv.Itoa(entry.Status))
+	buf.WriteByte(' ')
+	if entry.Bytes == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString(strconv.FormatInt(entry.Bytes, 10))
+	}
+}
+
+// 转义引号，反斜杠和控制字符，防止伪造日志行
+func escapeLogField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			b.WriteString(`\x`)
+			b.WriteByte("0123456789abcdef"[c>>4])
+			b.WriteByte("0123456789abcdef"[c&0xf])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
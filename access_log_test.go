@@ -0,0 +1,74 @@
+package ex
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 记录调用次数的JSON编解码器
+type countingJSONCodec struct {
+	StdJSONCodec
+	marshal int
+}
+
+func (c *countingJSONCodec) Marshal(v any) ([]byte, error) {
+	c.marshal++
+	return c.StdJSONCodec.Marshal(v)
+}
+
+func TestAccessLogJSONUsesEngineCodec(t *testing.T) {
+	var out bytes.Buffer
+	codec := &countingJSONCodec{}
+	e := NewEngine()
+	e.SetJSONCodec(codec)
+	e.Use(AccessLog(AccessLogConfig{Format: AccessLogJSON, Output: &out}))
+	e.GET("/ping", func(ctx *Context) { ctx.String(http.StatusOK, "pong") })
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	if codec.marshal != 1 {
+		t.Errorf("engine codec called %d times, want 1", codec.marshal)
+	}
+	if !strings.Contains(out.String(), `"path":"/ping"`) {
+		t.Errorf("log line = %q", out.String())
+	}
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{AccessLogCommon, `"GET /ping?x=1 HTTP/1.1" 200 4`},
+		{AccessLogCombined, `"GET /ping?x=1 HTTP/1.1" 200 4 "-" "agent \"q\""`},
+		{`{{.Method}} {{.URI}} {{.Status}}`, "GET /ping?x=1 200\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := NewEngine()
+		e.Use(AccessLog(AccessLogConfig{Format: tt.format, Output: &out}))
+		e.GET("/ping", func(ctx *Context) { ctx.String(http.StatusOK, "pong") })
+
+		req := httptest.NewRequest(http.MethodGet, "/ping?x=1", nil)
+		req.Header.Set("User-Agent", `agent "q"`)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("format %q: log line = %q, want it to contain %q", tt.format, out.String(), tt.want)
+		}
+	}
+}
+
+func TestNewAccessLogInvalidTemplate(t *testing.T) {
+	if _, err := NewAccessLog(AccessLogConfig{Format: "{{.Method"}); err == nil {
+		t.Error("NewAccessLog accepted an invalid template")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("AccessLog did not panic on an invalid template")
+		}
+	}()
+	AccessLog(AccessLogConfig{Format: "{{.Method"})
+}
@@ -0,0 +1,84 @@
+package ex
+
+/*
+ * 请求体绑定，各种格式都实现Binding接口
+ * 由Context.ShouldBindWith统一处理
+ */
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/BurntSushi/toml"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// 绑定接口
+type Binding interface {
+	Bind(r io.Reader, obj any) error
+}
+
+// 使用b把请求体解析到obj
+func (ctx *Context) ShouldBindWith(obj any, b Binding) error {
+	if ctx.Req.Body == nil {
+		return http.ErrBodyNotAllowed
+	}
+	return b.Bind(ctx.Req.Body, obj)
+}
+
+type jsonBinding struct {
+	codec JSONCodec
+}
+
+func (b jsonBinding) Bind(r io.Reader, obj any) error {
+	return b.codec.NewDecoder(r).Decode(obj)
+}
+
+type xmlBinding struct{}
+
+func (xmlBinding) Bind(r io.Reader, obj any) error {
+	return xml.NewDecoder(r).Decode(obj)
+}
+
+type yamlBinding struct{}
+
+func (yamlBinding) Bind(r io.Reader, obj any) error {
+	return yaml.NewDecoder(r).Decode(obj)
+}
+
+type tomlBinding struct{}
+
+func (tomlBinding) Bind(r io.Reader, obj any) error {
+	_, err := toml.NewDecoder(r).Decode(obj)
+	return err
+}
+
+type msgpackBinding struct{}
+
+func (msgpackBinding) Bind(r io.Reader, obj any) error {
+	return msgpack.NewDecoder(r).Decode(obj)
+}
+
+// protobuf，json为true时按protojson解析
+type protobufBinding struct {
+	json bool
+}
+
+func (b protobufBinding) Bind(r io.Reader, obj any) error {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return errors.New("object must implement proto.Message")
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if b.json {
+		return protojson.Unmarshal(body, msg)
+	}
+	return proto.Unmarshal(body, msg)
+}
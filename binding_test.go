@@ -0,0 +1,186 @@
+package ex
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/yaml.v3"
+)
+
+type bindUser struct {
+	XMLName xml.Name `xml:"user" yaml:"-" toml:"-" msgpack:"-"`
+	Name    string   `xml:"name" yaml:"name" toml:"name" msgpack:"name"`
+	Age     int      `xml:"age" yaml:"age" toml:"age" msgpack:"age"`
+	Tags    []string `xml:"tags>tag" yaml:"tags" toml:"tags" msgpack:"tags"`
+}
+
+// 把请求体绑定到bindUser，再用同一种格式原样响应回去
+func TestBindRenderRoundTrip(t *testing.T) {
+	want := bindUser{Name: "张三", Age: 30, Tags: []string{"a", "b"}}
+	tests := []struct {
+		name        string
+		contentType string
+		marshal     func(any) ([]byte, error)
+		unmarshal   func([]byte, any) error
+		bind        func(*Context, any) error
+		render      func(*Context, int, any)
+	}{
+		{"xml", xmlContentType, xml.Marshal, xml.Unmarshal, (*Context).ShouldBindXML, (*Context).XML},
+		{"yaml", yamlContentType, yaml.Marshal, yaml.Unmarshal, (*Context).ShouldBindYAML, (*Context).YAML},
+		{"toml", tomlContentType, toml.Marshal, toml.Unmarshal, (*Context).ShouldBindTOML, (*Context).TOML},
+		{"msgpack", msgpackContentType, msgpack.Marshal, msgpack.Unmarshal, (*Context).ShouldBindMsgPack, (*Context).MsgPack},
+	}
+	for _, tt := range tests {
+		body, err := tt.marshal(want)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", tt.name, err)
+		}
+
+		e := NewEngine()
+		e.POST("/user", func(ctx *Context) {
+			var u bindUser
+			if err := tt.bind(ctx, &u); err != nil {
+				ctx.String(http.StatusBadRequest, err.Error())
+				return
+			}
+			tt.render(ctx, http.StatusCreated, u)
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/user", bytes.NewReader(body))
+		req.Header.Set("Content-Type", tt.contentType)
+		e.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: status %d, body %q", tt.name, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: Content-Type %q, want %q", tt.name, ct, tt.contentType)
+		}
+		var got bindUser
+		if err := tt.unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: unmarshal response: %v", tt.name, err)
+		}
+		got.XMLName = xml.Name{}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
+
+func TestBindMalformedBody(t *testing.T) {
+	tests := []struct {
+		name string
+		bind func(*Context, any) error
+		body string
+	}{
+		{"xml", (*Context).ShouldBindXML, "<user><name>"},
+		{"yaml", (*Context).ShouldBindYAML, "name: [unclosed"},
+		{"toml", (*Context).ShouldBindTOML, "name = "},
+		{"msgpack", (*Context).ShouldBindMsgPack, "\xc1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		ctx := newContext(httptest.NewRecorder(), req)
+		var u bindUser
+		if err := tt.bind(ctx, &u); err == nil {
+			t.Errorf("%s: expected error for %q", tt.name, tt.body)
+		}
+	}
+}
+
+func TestRenderErrorSharedAcrossFormats(t *testing.T) {
+	// 无法编码的值统一返回500，并且不会写出部分内容
+	bad := map[string]any{"ch": make(chan int)}
+	tests := []struct {
+		name   string
+		render func(*Context, int, any)
+	}{
+		{"xml", (*Context).XML},
+		{"yaml", (*Context).YAML},
+		{"toml", (*Context).TOML},
+		{"msgpack", (*Context).MsgPack},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		ctx := newContext(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		tt.render(ctx, http.StatusOK, bad)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: status %d, want 500", tt.name, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Errorf("%s: Content-Type %q", tt.name, ct)
+		}
+	}
+}
+
+func TestProtoBufRoundTrip(t *testing.T) {
+	e := NewEngine()
+	e.POST("/echo", func(ctx *Context) {
+		var msg wrapperspb.StringValue
+		if err := ctx.ShouldBindProtoBuf(&msg); err != nil {
+			ctx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		msg.Value = strings.ToUpper(msg.Value)
+		ctx.ProtoBuf(http.StatusOK, &msg)
+	})
+
+	wire, _ := proto.Marshal(wrapperspb.String("hi"))
+	tests := []struct {
+		name        string
+		contentType string
+		accept      string
+		body        []byte
+		code        int
+		respType    string
+		respBody    string
+	}{
+		{"binary in, binary out", protobufContentType, protobufContentType, wire, http.StatusOK, protobufContentType, "\n\x02HI"},
+		{"binary in, json out", protobufContentType, MIMEJSON, wire, http.StatusOK, jsonContentType, `"HI"`},
+		{"json in, binary out", MIMEJSON, protobufContentType, []byte(`"hi"`), http.StatusOK, protobufContentType, "\n\x02HI"},
+		{"json in, json out", "application/json; charset=utf-8", "application/json", []byte(`"hi"`), http.StatusOK, jsonContentType, `"HI"`},
+		{"no Accept prefers binary", protobufContentType, "", wire, http.StatusOK, protobufContentType, "\n\x02HI"},
+		{"malformed binary", protobufContentType, "", []byte{0xff}, http.StatusBadRequest, "", ""},
+		{"malformed json", MIMEJSON, "", []byte(`{`), http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d (%q)", tt.name, w.Code, tt.code, w.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.respType {
+			t.Errorf("%s: Content-Type %q, want %q", tt.name, ct, tt.respType)
+		}
+		if w.Body.String() != tt.respBody {
+			t.Errorf("%s: body %q, want %q", tt.name, w.Body.String(), tt.respBody)
+		}
+	}
+}
+
+func TestShouldBindProtoBufRequiresMessage(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(""))
+	ctx := newContext(httptest.NewRecorder(), req)
+	var s string
+	if err := ctx.ShouldBindWith(&s, protobufBinding{}); err == nil {
+		t.Fatal("expected error for non proto.Message target")
+	}
+}
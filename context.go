@@ -4,16 +4,16 @@ package ex
  *  用于封装请求上下文
  */
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
 
-	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
 )
 
 type HandlerFunc func(*Context)
@@ -27,16 +27,29 @@ type Context struct {
 	StatusCode int
 	handlers   []HandlerFunc
 	index      int
+	engine     *Engine
+	requestID  string
+	// RequestID中间件使用的请求头名字，转发请求id时使用
+	requestIDHeader string
 }
 
 func newContext(w http.ResponseWriter, r *http.Request) *Context {
-	return &Context{
-		Writer: w,
+	ctx := &Context{
 		Req:    r,
 		Path:   r.URL.Path,
 		Method: r.Method,
 		index:  -1,
 	}
+	ctx.Writer = &responseWriter{ResponseWriter: w, ctx: ctx}
+	return ctx
+}
+
+// 获取当前请求使用的JSON编解码器
+func (ctx *Context) JSONCodec() JSONCodec {
+	if ctx.engine != nil {
+		return ctx.engine.JSONCodec()
+	}
+	return DefaultJSONCodec
 }
 
 func (ctx *Context) Abort() {
@@ -59,38 +72,136 @@ func (ctx *Context) String(code int, msg string) {
 
 // 响应http json
 func (ctx *Context) Json(code int, obj any) {
-	ctx.Writer.Header().Set("Content-Type", "application/json")
-	ctx.Status(code)
-	enCoder := json.NewEncoder(ctx.Writer)
-	if err := enCoder.Encode(obj); err != nil {
-		http.Error(ctx.Writer, err.Error(), 500)
+	ctx.Render(code, jsonRender{codec: ctx.JSONCodec(), data: obj})
+}
+
+// 响应带缩进的json，适合调试接口使用
+func (ctx *Context) IndentedJSON(code int, obj any) {
+	ctx.Render(code, indentedJSONRender{codec: ctx.JSONCodec(), data: obj})
+}
+
+// 响应带防劫持前缀的json，前缀可以通过Engine.SetSecureJSONPrefix修改
+func (ctx *Context) SecureJSON(code int, obj any) {
+	prefix := defaultSecureJSONPrefix
+	if ctx.engine != nil {
+		prefix = ctx.engine.secureJSONPrefix
+	}
+	ctx.Render(code, secureJSONRender{codec: ctx.JSONCodec(), prefix: prefix, data: obj})
+}
+
+// 响应jsonp，回调函数名取自callback查询参数，为空时等同于json
+func (ctx *Context) JSONP(code int, obj any) {
+	callback := ctx.Query("callback")
+	if !validJSONPCallback(callback) {
+		ctx.String(http.StatusBadRequest, "invalid jsonp callback")
+		return
+	}
+	ctx.Render(code, jsonpRender{codec: ctx.JSONCodec(), callback: callback, data: obj})
+}
+
+// 响应只包含ascii字符的json
+func (ctx *Context) AsciiJSON(code int, obj any) {
+	ctx.Render(code, asciiJSONRender{codec: ctx.JSONCodec(), data: obj})
+}
+
+// 响应不转义html字符的json
+func (ctx *Context) PureJSON(code int, obj any) {
+	ctx.Render(code, pureJSONRender{codec: ctx.JSONCodec(), data: obj})
+}
+
+// 响应http xml
+func (ctx *Context) XML(code int, obj any) {
+	ctx.Render(code, xmlRender{data: obj})
+}
+
+// 响应http yaml
+func (ctx *Context) YAML(code int, obj any) {
+	ctx.Render(code, yamlRender{data: obj})
+}
+
+// 响应http toml
+func (ctx *Context) TOML(code int, obj any) {
+	ctx.Render(code, tomlRender{data: obj})
+}
+
+// 响应http msgpack
+func (ctx *Context) MsgPack(code int, obj any) {
+	ctx.Render(code, msgpackRender{data: obj})
+}
+
+// 响应protobuf，客户端Accept要求json时使用protojson编码
+func (ctx *Context) ProtoBuf(code int, msg proto.Message) {
+	ctx.Render(code, protobufRender{json: ctx.wantsProtoJSON(), data: msg})
+}
+
+// 协商结果为json时认为客户端需要protojson
+func (ctx *Context) wantsProtoJSON() bool {
+	return ctx.NegotiateFormat(MIMEProtoBuf, MIMEJSON) == MIMEJSON
+}
+
+// 回调函数名只允许字母，数字，下划线，$和.，防止注入脚本
+func validJSONPCallback(callback string) bool {
+	if len(callback) > 128 {
+		return false
+	}
+	for _, c := range callback {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '$', c == '.':
+		default:
+			return false
+		}
 	}
+	return true
 }
 
-// serve sent evnet支持
+// serve sent evnet支持，响应头只在第一次调用时设置
+// 需要id，retry和心跳时请使用SSE
 func (ctx *Context) SSEvent(event string, content any) {
-	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
-	ctx.Writer.Header().Set("Cache-Control", "no-cache")
-	ctx.Writer.Header().Set("Connection", "keep-alive")
+	if ctx.Writer.Header().Get("Content-Type") != "text/event-stream" {
+		setSSEHeaders(ctx.Writer.Header())
+	}
 
 	var payload string
 	switch v := content.(type) {
 	case string:
 		payload = v
 	default:
-		jsonByte, err := json.Marshal(v)
+		jsonByte, err := ctx.JSONCodec().Marshal(v)
 		if err != nil {
 			payload = fmt.Sprintf("%v", v)
 		} else {
 			payload = string(jsonByte)
 		}
 	}
-	fmt.Fprintf(ctx.Writer, "event: %s\n", event)
-	fmt.Fprintf(ctx.Writer, "data: %s\n\n", payload)
+	writeSSEEvent(ctx.Writer, SSEEvent{Event: event, Data: payload}, ctx.JSONCodec())
+	ctx.flush()
+}
+
+// 重定向到location，code必须是3xx，201也允许用于创建资源后跳转
+func (ctx *Context) Redirect(code int, location string) {
+	if (code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect) && code != http.StatusCreated {
+		panic(fmt.Sprintf("cannot redirect with status code %d", code))
+	}
+	http.Redirect(ctx.Writer, ctx.Req, location, code)
+}
 
-	if flusher, ok := ctx.Writer.(http.Flusher); ok {
-		flusher.Flush()
+// 重定向到命名路由，GET和HEAD请求使用302，其他请求使用303让客户端改用GET(POST-redirect-GET)
+// 路由不存在或者缺少参数时返回错误，此时不会写任何响应
+func (ctx *Context) RedirectToRoute(name string, params map[string]string) error {
+	if ctx.engine == nil {
+		return errors.New("cannot redirect to route without engine")
+	}
+	location, err := ctx.engine.URL(name, params)
+	if err != nil {
+		return err
+	}
+	code := http.StatusSeeOther
+	if ctx.Method == http.MethodGet || ctx.Method == http.MethodHead {
+		code = http.StatusFound
 	}
+	ctx.Redirect(code, location)
+	return nil
 }
 
 // 获取URL参数
@@ -99,16 +210,36 @@ func (ctx *Context) Query(key string) string {
 }
 
 func (ctx *Context) Status(code int) {
-	ctx.StatusCode = code
+	if !ctx.Written() {
+		ctx.StatusCode = code
+	}
 	ctx.Writer.WriteHeader(code)
 }
 
 func (ctx *Context) ShouldBindJson(obj any) error {
-	if ctx.Req.Body == nil {
-		return http.ErrBodyNotAllowed
-	}
-	decoder := json.NewDecoder(ctx.Req.Body)
-	return decoder.Decode(obj)
+	return ctx.ShouldBindWith(obj, jsonBinding{codec: ctx.JSONCodec()})
+}
+
+func (ctx *Context) ShouldBindXML(obj any) error {
+	return ctx.ShouldBindWith(obj, xmlBinding{})
+}
+
+func (ctx *Context) ShouldBindYAML(obj any) error {
+	return ctx.ShouldBindWith(obj, yamlBinding{})
+}
+
+func (ctx *Context) ShouldBindTOML(obj any) error {
+	return ctx.ShouldBindWith(obj, tomlBinding{})
+}
+
+func (ctx *Context) ShouldBindMsgPack(obj any) error {
+	return ctx.ShouldBindWith(obj, msgpackBinding{})
+}
+
+// 解析protobuf请求体，Content-Type为application/json时按protojson解析
+func (ctx *Context) ShouldBindProtoBuf(msg proto.Message) error {
+	mediaType, _, _ := mime.ParseMediaType(ctx.Req.Header.Get("Content-Type"))
+	return ctx.ShouldBindWith(msg, protobufBinding{json: mediaType == MIMEJSON})
 }
 
 func (ctx *Context) ShouldBindQuery(obj any) error {
@@ -169,21 +300,6 @@ func (ctx *Context) ShouldBindQuery(obj any) error {
 	return nil
 }
 
-// websocket支持
-var wsUpgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
-func (ctx *Context) Websocket(handler func(*websocket.Conn)) error {
-	conn, err := wsUpgrader.Upgrade(ctx.Writer, ctx.Req, nil)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-	handler(conn)
-	return nil
-}
-
 func (ctx *Context) RealIP() string {
 	ip := ctx.Req.Header.Get("X-Forwarded-For")
 	if ip != "" {
@@ -0,0 +1,201 @@
+package ex
+
+/*
+ * cookie操作，支持HMAC签名和AES-GCM加密的cookie
+ * 密钥支持轮换，第一个密钥用于签名/加密，所有密钥都可以用于验证/解密
+ */
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// 没有配置密钥时返回
+	ErrCookieKeyMissing = errors.New("cookie keys not configured")
+	// cookie签名错误，被篡改或者无法解密时返回
+	ErrInvalidCookie = errors.New("invalid cookie")
+)
+
+// 设置cookie的选项
+type CookieOptions struct {
+	// 为空时为"/"
+	Path   string
+	Domain string
+	// 大于0时为有效秒数，小于0时删除cookie，等于0时为会话cookie
+	MaxAge   int
+	Expires  time.Time
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+	// CHIPS分区cookie，要求Secure
+	Partitioned bool
+}
+
+// 设置签名cookie使用的密钥，第一个用于签名，其余的用于验证旧cookie
+func (e *Engine) SetCookieKeys(keys ...[]byte) {
+	e.cookieKeys = keys
+}
+
+// 设置加密cookie使用的密钥，长度必须是16，24或32字节
+// 第一个用于加密，其余的用于解密旧cookie
+func (e *Engine) SetCookieEncryptionKeys(keys ...[]byte) error {
+	aeads := make([]cipher.AEAD, 0, len(keys))
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		aeads = append(aeads, aead)
+	}
+	e.cookieAEADs = aeads
+	return nil
+}
+
+// 获取cookie的值
+func (ctx *Context) Cookie(name string) (string, error) {
+	cookie, err := ctx.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// 设置cookie，SameSite=None和Partitioned会自动设置Secure
+func (ctx *Context) SetCookie(name, value string, opts CookieOptions) {
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	cookie := &http.Cookie{
+		Name:        name,
+		Value:       value,
+		Path:        opts.Path,
+		Domain:      opts.Domain,
+		MaxAge:      opts.MaxAge,
+		Expires:     opts.Expires,
+		Secure:      opts.Secure || opts.Partitioned || opts.SameSite == http.SameSiteNoneMode,
+		HttpOnly:    opts.HttpOnly,
+		SameSite:    opts.SameSite,
+		Partitioned: opts.Partitioned,
+	}
+	http.SetCookie(ctx.Writer, cookie)
+}
+
+// 设置签名cookie，客户端可以看到内容但无法篡改
+func (ctx *Context) SetSignedCookie(name, value string, opts CookieOptions) error {
+	keys := ctx.cookieKeys()
+	if len(keys) == 0 {
+		return ErrCookieKeyMissing
+	}
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	sig := signCookie(keys[0], name, encoded)
+	ctx.SetCookie(name, encoded+"."+sig, opts)
+	return nil
+}
+
+// 获取并验证签名cookie
+func (ctx *Context) SignedCookie(name string) (string, error) {
+	keys := ctx.cookieKeys()
+	if len(keys) == 0 {
+		return "", ErrCookieKeyMissing
+	}
+	raw, err := ctx.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return verifySignedCookie(keys, name, raw)
+}
+
+// 设置加密cookie，客户端无法查看和篡改内容
+func (ctx *Context) SetEncryptedCookie(name, value string, opts CookieOptions) error {
+	aeads := ctx.cookieAEADs()
+	if len(aeads) == 0 {
+		return ErrCookieKeyMissing
+	}
+	aead := aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// cookie名作为附加数据，防止把一个cookie的值挪到另一个cookie上使用
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	ctx.SetCookie(name, base64.RawURLEncoding.EncodeToString(sealed), opts)
+	return nil
+}
+
+// 获取并解密加密cookie
+func (ctx *Context) EncryptedCookie(name string) (string, error) {
+	aeads := ctx.cookieAEADs()
+	if len(aeads) == 0 {
+		return "", ErrCookieKeyMissing
+	}
+	raw, err := ctx.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, aead := range aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if plain, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return string(plain), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+func (ctx *Context) cookieKeys() [][]byte {
+	if ctx.engine == nil {
+		return nil
+	}
+	return ctx.engine.cookieKeys
+}
+
+func (ctx *Context) cookieAEADs() []cipher.AEAD {
+	if ctx.engine == nil {
+		return nil
+	}
+	return ctx.engine.cookieAEADs
+}
+
+// 签名包含cookie名，防止把一个cookie的值挪到另一个cookie上使用
+func signCookie(key []byte, name, value string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func verifySignedCookie(keys [][]byte, name, raw string) (string, error) {
+	encoded, sig, ok := strings.Cut(raw, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		if hmac.Equal([]byte(sig), []byte(signCookie(key, name, encoded))) {
+			value, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
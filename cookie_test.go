@@ -0,0 +1,218 @@
+package ex
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	cookieKeyNew = []byte("new-signing-key")
+	cookieKeyOld = []byte("old-signing-key")
+	cookieAESNew = bytes.Repeat([]byte{1}, 32)
+	cookieAESOld = bytes.Repeat([]byte{2}, 16)
+)
+
+func newCookieContext(e *Engine, cookies ...*http.Cookie) (*Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	ctx := newContext(w, req)
+	ctx.engine = e
+	return ctx, w
+}
+
+// 取出响应中名为name的cookie
+func responseCookie(t *testing.T, w *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("cookie %q not set", name)
+	return nil
+}
+
+type cookieCodec struct {
+	name    string
+	set     func(*Context, string, string, CookieOptions) error
+	get     func(*Context, string) (string, error)
+	setKeys func(e *Engine, keys ...[]byte) error
+	// 当前密钥和轮换前的旧密钥
+	current, previous []byte
+}
+
+var cookieCodecs = []cookieCodec{
+	{
+		name: "signed",
+		set:  (*Context).SetSignedCookie,
+		get:  (*Context).SignedCookie,
+		setKeys: func(e *Engine, keys ...[]byte) error {
+			e.SetCookieKeys(keys...)
+			return nil
+		},
+		current:  cookieKeyNew,
+		previous: cookieKeyOld,
+	},
+	{
+		name:     "encrypted",
+		set:      (*Context).SetEncryptedCookie,
+		get:      (*Context).EncryptedCookie,
+		setKeys:  (*Engine).SetCookieEncryptionKeys,
+		current:  cookieAESNew,
+		previous: cookieAESOld,
+	},
+}
+
+func newCookieEngine(t *testing.T, codec cookieCodec, keys ...[]byte) *Engine {
+	t.Helper()
+	e := NewEngine()
+	if err := codec.setKeys(e, keys...); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestSecureCookieRoundTrip(t *testing.T) {
+	for _, codec := range cookieCodecs {
+		e := newCookieEngine(t, codec, codec.current, codec.previous)
+
+		ctx, w := newCookieContext(e)
+		value := "uid=42; 中文|."
+		if err := codec.set(ctx, "session", value, CookieOptions{HttpOnly: true}); err != nil {
+			t.Fatalf("%s: set: %v", codec.name, err)
+		}
+		c := responseCookie(t, w, "session")
+		if strings.Contains(c.Value, "42") {
+			t.Errorf("%s: cookie value %q leaks plaintext", codec.name, c.Value)
+		}
+
+		ctx, _ = newCookieContext(e, c)
+		got, err := codec.get(ctx, "session")
+		if err != nil || got != value {
+			t.Errorf("%s: got %q, %v; want %q", codec.name, got, err, value)
+		}
+	}
+}
+
+func TestSecureCookieRejectsTampering(t *testing.T) {
+	for _, codec := range cookieCodecs {
+		e := newCookieEngine(t, codec, codec.current)
+
+		ctx, w := newCookieContext(e)
+		if err := codec.set(ctx, "role", "user", CookieOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		c := responseCookie(t, w, "role")
+
+		// 最后一个字符可能只包含填充位，所以改中间的字符
+		mid := len(c.Value) / 2
+		tampered := []string{
+			c.Value[:mid] + string(c.Value[mid]^1) + c.Value[mid+1:],
+			"",
+			"no-signature",
+			"!!!.!!!",
+		}
+		if codec.name == "signed" {
+			// 改内容但保留原签名
+			_, sig, _ := strings.Cut(c.Value, ".")
+			tampered = append(tampered, base64.RawURLEncoding.EncodeToString([]byte("admin"))+"."+sig)
+		}
+		for _, v := range tampered {
+			ctx, _ := newCookieContext(e, &http.Cookie{Name: "role", Value: v})
+			if got, err := codec.get(ctx, "role"); !errors.Is(err, ErrInvalidCookie) {
+				t.Errorf("%s: tampered value %q accepted as %q (err %v)", codec.name, v, got, err)
+			}
+		}
+
+		// 同样的值放到另一个cookie名下
+		ctx, _ = newCookieContext(e, &http.Cookie{Name: "admin", Value: c.Value})
+		if _, err := codec.get(ctx, "admin"); !errors.Is(err, ErrInvalidCookie) {
+			t.Errorf("%s: value moved to another name accepted (err %v)", codec.name, err)
+		}
+	}
+}
+
+func TestSecureCookieKeyRotation(t *testing.T) {
+	for _, codec := range cookieCodecs {
+		// 轮换前只有旧密钥时签发的cookie
+		ctx, w := newCookieContext(newCookieEngine(t, codec, codec.previous))
+		if err := codec.set(ctx, "session", "v1", CookieOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		old := responseCookie(t, w, "session")
+
+		// 旧密钥还在列表中时可以验证
+		e := newCookieEngine(t, codec, codec.current, codec.previous)
+		ctx, _ = newCookieContext(e, old)
+		if got, err := codec.get(ctx, "session"); err != nil || got != "v1" {
+			t.Errorf("%s: old cookie with old key listed: %q, %v", codec.name, got, err)
+		}
+
+		// 新写入的cookie使用第一个密钥，移除旧密钥后依然有效
+		ctx, w = newCookieContext(e)
+		if err := codec.set(ctx, "session", "v2", CookieOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		fresh := responseCookie(t, w, "session")
+
+		rotated := newCookieEngine(t, codec, codec.current)
+		ctx, _ = newCookieContext(rotated, old)
+		if _, err := codec.get(ctx, "session"); !errors.Is(err, ErrInvalidCookie) {
+			t.Errorf("%s: old cookie accepted after key removed (err %v)", codec.name, err)
+		}
+		ctx, _ = newCookieContext(rotated, fresh)
+		if got, err := codec.get(ctx, "session"); err != nil || got != "v2" {
+			t.Errorf("%s: fresh cookie after rotation: %q, %v", codec.name, got, err)
+		}
+	}
+}
+
+func TestSecureCookieErrors(t *testing.T) {
+	for _, codec := range cookieCodecs {
+		ctx, _ := newCookieContext(NewEngine())
+		if err := codec.set(ctx, "a", "b", CookieOptions{}); !errors.Is(err, ErrCookieKeyMissing) {
+			t.Errorf("%s: set without keys: %v", codec.name, err)
+		}
+		if _, err := codec.get(ctx, "a"); !errors.Is(err, ErrCookieKeyMissing) {
+			t.Errorf("%s: get without keys: %v", codec.name, err)
+		}
+
+		ctx, _ = newCookieContext(newCookieEngine(t, codec, codec.current))
+		if _, err := codec.get(ctx, "missing"); !errors.Is(err, http.ErrNoCookie) {
+			t.Errorf("%s: missing cookie: %v", codec.name, err)
+		}
+	}
+
+	if err := NewEngine().SetCookieEncryptionKeys([]byte("short")); err == nil {
+		t.Error("SetCookieEncryptionKeys should reject invalid key sizes")
+	}
+}
+
+func TestSetCookieSecureDefaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   CookieOptions
+		secure bool
+		path   string
+	}{
+		{"default path", CookieOptions{}, false, "/"},
+		{"SameSite=None forces Secure", CookieOptions{SameSite: http.SameSiteNoneMode}, true, "/"},
+		{"Partitioned forces Secure", CookieOptions{Partitioned: true, Path: "/app"}, true, "/app"},
+	}
+	for _, tt := range tests {
+		ctx, w := newCookieContext(NewEngine())
+		ctx.SetCookie("c", "v", tt.opts)
+		c := responseCookie(t, w, "c")
+		if c.Secure != tt.secure || c.Path != tt.path {
+			t.Errorf("%s: Secure %v Path %q, want %v %q", tt.name, c.Secure, c.Path, tt.secure, tt.path)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// 创建使用CORS中间件的引擎，/data注册了GET和OPTIONS，/nooptions只注册了GET
+func newCORSEngine(t *testing.T, config CORSConfig) *Engine {
+	t.Helper()
+	handler, err := NewCORS(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine()
+	e.Use(handler)
+	e.GET("/data", func(ctx *Context) { ctx.String(http.StatusOK, "data") })
+	e.OPTIONS("/data", func(ctx *Context) { ctx.String(http.StatusOK, "options handler") })
+	e.GET("/nooptions", func(ctx *Context) { ctx.String(http.StatusOK, "data") })
+	return e
+}
+
+func corsRequest(e *Engine, method, path, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func preflightHeaders(method string) map[string]string {
+	return map[string]string{"Access-Control-Request-Method": method}
+}
+
+func hasVary(h http.Header, value string) bool {
+	return slices.Contains(h.Values("Vary"), value)
+}
+
+func TestCORSWildcardWithCredentialsReflectsOrigin(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+	w := corsRequest(e, http.MethodGet, "/data", "https://app.example.com", nil)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	if !hasVary(w.Header(), "Origin") {
+		t.Errorf("Vary = %q, want Origin", w.Header().Values("Vary"))
+	}
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"*"}})
+	w := corsRequest(e, http.MethodGet, "/data", "https://app.example.com", nil)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want it unset", got)
+	}
+	// 响应不随Origin变化时不需要Vary: Origin
+	if hasVary(w.Header(), "Origin") {
+		t.Errorf("Vary = %q, want no Origin", w.Header().Values("Vary"))
+	}
+}
+
+func TestCORSVaryOrigin(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"https://app.example.com"}})
+	for _, origin := range []string{"https://app.example.com", "https://evil.example.net", ""} {
+		w := corsRequest(e, http.MethodGet, "/data", origin, nil)
+		if !hasVary(w.Header(), "Origin") {
+			t.Errorf("origin %q: Vary = %q, want Origin", origin, w.Header().Values("Vary"))
+		}
+	}
+
+	w := corsRequest(e, http.MethodOptions, "/data", "https://app.example.com", preflightHeaders(http.MethodGet))
+	for _, v := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+		if !hasVary(w.Header(), v) {
+			t.Errorf("preflight Vary = %q, want %s", w.Header().Values("Vary"), v)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{http.MethodGet, http.MethodPut},
+		MaxAge:       600,
+	})
+	w := corsRequest(e, http.MethodOptions, "/data", "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "X-Custom, Content-Type",
+	})
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("preflight reached the OPTIONS handler: %q", w.Body.String())
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, PUT",
+		"Access-Control-Allow-Headers": "X-Custom, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestCORSMaxAgeUnset(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"*"}})
+	w := corsRequest(e, http.MethodOptions, "/data", "https://app.example.com", preflightHeaders(http.MethodGet))
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("Access-Control-Max-Age = %q, want it unset", got)
+	}
+}
+
+func TestCORSPlainOptionsPassesThrough(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"*"}})
+	// 没有Access-Control-Request-Method的OPTIONS请求不是预检请求
+	for _, origin := range []string{"", "https://app.example.com"} {
+		w := corsRequest(e, http.MethodOptions, "/data", origin, nil)
+		if w.Code != http.StatusOK || w.Body.String() != "options handler" {
+			t.Errorf("origin %q: got %d %q, want the OPTIONS handler", origin, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != "" {
+			t.Errorf("origin %q: Access-Control-Allow-Methods = %q on a non-preflight request", origin, got)
+		}
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"https://app.example.com"}, AllowCredentials: true})
+
+	w := corsRequest(e, http.MethodGet, "/data", "https://evil.example.net", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "data" {
+		t.Errorf("simple request got %d %q, want it to reach the handler", w.Code, w.Body.String())
+	}
+	for _, k := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials"} {
+		if got := w.Header().Get(k); got != "" {
+			t.Errorf("%s = %q for a disallowed origin", k, got)
+		}
+	}
+
+	w = corsRequest(e, http.MethodOptions, "/data", "https://evil.example.net", preflightHeaders(http.MethodGet))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d, want 204", w.Code)
+	}
+	for _, k := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods"} {
+		if got := w.Header().Get(k); got != "" {
+			t.Errorf("preflight %s = %q for a disallowed origin", k, got)
+		}
+	}
+}
+
+func TestCORSSubdomainWildcard(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"https://*.example.com"}})
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://api.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"https://evilexample.com", false},
+		{"http://api.example.com", false},
+		{"https://api.example.com.evil.net", false},
+	}
+	for _, tt := range tests {
+		w := corsRequest(e, http.MethodGet, "/data", tt.origin, nil)
+		got := w.Header().Get("Access-Control-Allow-Origin") == tt.origin
+		if got != tt.allowed {
+			t.Errorf("origin %q: allowed = %v, want %v", tt.origin, got, tt.allowed)
+		}
+	}
+}
+
+func TestCORSOriginRegexIsAnchored(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOriginRegex: []string{`https://app\.example\.com`, `http://localhost:\d+`}})
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"http://localhost:3000", true},
+		{"https://app.example.com.evil.net", false},
+		{"https://evil.net/https://app.example.com", false},
+		{"http://localhost:3000.evil.net", false},
+	}
+	for _, tt := range tests {
+		w := corsRequest(e, http.MethodGet, "/data", tt.origin, nil)
+		got := w.Header().Get("Access-Control-Allow-Origin") == tt.origin
+		if got != tt.allowed {
+			t.Errorf("origin %q: allowed = %v, want %v", tt.origin, got, tt.allowed)
+		}
+	}
+}
+
+func TestCORSInvalidOriginRegex(t *testing.T) {
+	if _, err := NewCORS(CORSConfig{AllowOriginRegex: []string{`(`}}); err == nil {
+		t.Error("NewCORS accepted an invalid regex")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("CORS did not panic on an invalid regex")
+		}
+	}()
+	CORS(CORSConfig{AllowOriginRegex: []string{`(`}})
+}
+
+func TestCORSAllowOriginFunc(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOriginFunc: func(origin string) bool {
+		return origin == "https://partner.example.org"
+	}})
+	w := corsRequest(e, http.MethodGet, "/data", "https://partner.example.org", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://partner.example.org" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	w = corsRequest(e, http.MethodGet, "/data", "https://other.example.org", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for a rejected origin", got)
+	}
+}
+
+func TestCORSPrivateNetwork(t *testing.T) {
+	pna := map[string]string{
+		"Access-Control-Request-Method":          http.MethodGet,
+		"Access-Control-Request-Private-Network": "true",
+	}
+
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"https://app.example.com"}, AllowPrivateNetwork: true})
+	w := corsRequest(e, http.MethodOptions, "/data", "https://app.example.com", pna)
+	if got := w.Header().Get("Access-Control-Allow-Private-Network"); got != "true" {
+		t.Errorf("Access-Control-Allow-Private-Network = %q, want true", got)
+	}
+	w = corsRequest(e, http.MethodOptions, "/data", "https://app.example.com", preflightHeaders(http.MethodGet))
+	if got := w.Header().Get("Access-Control-Allow-Private-Network"); got != "" {
+		t.Errorf("Access-Control-Allow-Private-Network = %q without the request header", got)
+	}
+
+	e = newCORSEngine(t, CORSConfig{AllowOrigins: []string{"https://app.example.com"}})
+	w = corsRequest(e, http.MethodOptions, "/data", "https://app.example.com", pna)
+	if got := w.Header().Get("Access-Control-Allow-Private-Network"); got != "" {
+		t.Errorf("Access-Control-Allow-Private-Network = %q when not enabled", got)
+	}
+}
+
+func TestCORSExposeHeaders(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"*"}, ExposeHeaders: []string{"X-Total", "X-Page"}})
+	w := corsRequest(e, http.MethodGet, "/data", "https://app.example.com", nil)
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Total, X-Page" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+}
+
+func TestCORSPreflightWithoutOptionsRoute(t *testing.T) {
+	e := newCORSEngine(t, CORSConfig{AllowOrigins: []string{"https://app.example.com"}})
+
+	// 没有匹配的路由时全局中间件仍然会执行，预检请求不会得到404
+	w := corsRequest(e, http.MethodOptions, "/nooptions", "https://app.example.com", preflightHeaders(http.MethodGet))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got == "" {
+		t.Error("Access-Control-Allow-Methods is missing")
+	}
+
+	// 不是预检请求时仍然返回404
+	w = corsRequest(e, http.MethodOptions, "/nooptions", "https://app.example.com", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("plain OPTIONS status = %d, want 404", w.Code)
+	}
+}
+
+func TestDefaultCORS(t *testing.T) {
+	e := NewEngine()
+	e.Use(DefaultCORS())
+	e.GET("/data", func(ctx *Context) { ctx.String(http.StatusOK, "data") })
+
+	w := corsRequest(e, http.MethodOptions, "/data", "https://app.example.com", preflightHeaders(http.MethodPost))
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want it unset", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "86400" {
+		t.Errorf("Access-Control-Max-Age = %q, want 86400", got)
+	}
+}
@@ -3,7 +3,12 @@ package ex
 /*
  * 这个文件是egine的内容，暂时先写这么多注释
  */
-import "net/http"
+import (
+	"context"
+	"crypto/cipher"
+	"net/http"
+	"sync"
+)
 
 // ex web框架的引擎结构体
 type Engine struct {
@@ -11,6 +16,22 @@ type Engine struct {
 	router     *Router
 	groups     []*RouterGroup
 	dispatcher *Dispatcher
+	jsonCodec  JSONCodec
+
+	secureJSONPrefix string
+
+	html          htmlLoader
+	htmlTemplates *htmlTemplates
+	debug         bool
+
+	wsConfig WebsocketConfig
+
+	cookieKeys  [][]byte
+	cookieAEADs []cipher.AEAD
+
+	server        *http.Server
+	mu            sync.Mutex
+	shutdownHooks []func()
 }
 
 // 实例化引擎
@@ -24,6 +45,7 @@ func NewEngine() *Engine {
 
 	e.groups = []*RouterGroup{e.RouterGroup}
 	e.dispatcher = newDispatcher()
+	e.secureJSONPrefix = defaultSecureJSONPrefix
 	return e
 }
 
@@ -37,13 +59,63 @@ func DefaultEngine() *Engine {
 // 必须实现ServeHTTP方法
 func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := newContext(w, r)
+	ctx.engine = e
+	e.handle(ctx)
+}
+
+// 按照ctx.Req.URL.Path重新分发请求，可以在修改路径后用于内部重定向
+func (e *Engine) HandleContext(ctx *Context) {
+	ctx.engine = e
+	ctx.Path = ctx.Req.URL.Path
+	ctx.Method = ctx.Req.Method
+	ctx.handlers = nil
+	ctx.index = -1
+	e.handle(ctx)
+}
 
+func (e *Engine) handle(ctx *Context) {
 	// 这里先执行模块调度
 	if e.dispatcher.Dispatch(ctx) {
 		return
 	}
 	// 再走普通的路由
-	e.router.handle(ctx)
+	if e.router.handle(ctx) {
+		return
+	}
+	// 没有匹配的路由时也执行全局中间件，这样CORS预检和404也能被处理和记录
+	ctx.handlers = append(append([]HandlerFunc(nil), e.middlewares...), func(ctx *Context) {
+		ctx.String(http.StatusNotFound, "404 NOT FOUND")
+	})
+	ctx.index = -1
+	ctx.Next()
+}
+
+// 根据路由名生成地址
+func (e *Engine) URL(name string, params map[string]string) (string, error) {
+	return e.router.url(name, params)
+}
+
+// 设置JSON编解码器，传nil则恢复为DefaultJSONCodec
+func (e *Engine) SetJSONCodec(codec JSONCodec) {
+	e.jsonCodec = codec
+}
+
+// 获取引擎当前使用的JSON编解码器
+func (e *Engine) JSONCodec() JSONCodec {
+	if e.jsonCodec != nil {
+		return e.jsonCodec
+	}
+	return DefaultJSONCodec
+}
+
+// 设置调试模式，调试模式下每次请求都会重新解析html模板
+func (e *Engine) SetDebug(debug bool) {
+	e.debug = debug
+}
+
+// 设置SecureJSON使用的前缀
+func (e *Engine) SetSecureJSONPrefix(prefix string) {
+	e.secureJSONPrefix = prefix
 }
 
 // 添加一个路由
@@ -58,12 +130,42 @@ func (e *Engine) Use(middlewares ...HandlerFunc) {
 
 // 启动一个http server
 func (e *Engine) Run(addr string) error {
-	return http.ListenAndServe(addr, e)
+	return e.newServer(addr).ListenAndServe()
 }
 
 // 启动一个https server
 func (e *Engine) RunTSL(addr, cert, key string) error {
-	return http.ListenAndServeTLS(addr, cert, key, e)
+	return e.newServer(addr).ListenAndServeTLS(cert, key)
+}
+
+func (e *Engine) newServer(addr string) *http.Server {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.server = &http.Server{Addr: addr, Handler: e}
+	return e.server
+}
+
+// 注册一个在Shutdown时调用的函数，用于关闭websocket这类被接管的长连接
+func (e *Engine) RegisterOnShutdown(f func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdownHooks = append(e.shutdownHooks, f)
+}
+
+// 优雅关闭，先调用注册的关闭函数，再等待正在处理的请求结束
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	hooks := e.shutdownHooks
+	server := e.server
+	e.mu.Unlock()
+
+	for _, f := range hooks {
+		f()
+	}
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
 
 // 实现http GET请求
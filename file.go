@@ -0,0 +1,119 @@
+package ex
+
+/*
+ * 文件响应，Range和条件请求(If-Modified-Since, If-None-Match等)交给http.ServeContent处理
+ */
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 响应本地文件
+func (ctx *Context) File(filepath string) {
+	http.ServeFile(ctx.Writer, ctx.Req, filepath)
+}
+
+// 以附件的形式响应本地文件，浏览器会使用downloadName作为保存的文件名
+func (ctx *Context) FileAttachment(path, downloadName string) {
+	if downloadName == "" {
+		downloadName = filepath.Base(path)
+	}
+	ctx.Writer.Header().Set("Content-Disposition", contentDisposition("attachment", downloadName))
+	http.ServeFile(ctx.Writer, ctx.Req, path)
+}
+
+// 从fs中响应文件，可以配合http.FS(embed.FS)使用
+func (ctx *Context) FileFromFS(path string, fs http.FileSystem) {
+	f, err := fs.Open(path)
+	if err != nil {
+		ctx.String(http.StatusNotFound, "404 NOT FOUND")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		ctx.String(http.StatusNotFound, "404 NOT FOUND")
+		return
+	}
+	http.ServeContent(ctx.Writer, ctx.Req, info.Name(), info.ModTime(), f)
+}
+
+// 从reader中响应数据，length小于0表示长度未知
+// reader实现了io.ReadSeeker时支持Range和条件请求，此时headers中的Last-Modified和ETag会参与判断
+func (ctx *Context) DataFromReader(code int, length int64, contentType string, reader io.Reader, headers map[string]string) {
+	header := ctx.Writer.Header()
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	if rs, ok := reader.(io.ReadSeeker); ok && code == http.StatusOK {
+		modtime, _ := http.ParseTime(header.Get("Last-Modified"))
+		http.ServeContent(ctx.Writer, ctx.Req, "", modtime, rs)
+		return
+	}
+
+	if length >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	ctx.Status(code)
+	io.Copy(ctx.Writer, reader)
+}
+
+// 按照RFC 6266生成Content-Disposition，非ascii文件名使用filename*编码
+func contentDisposition(dispositionType, filename string) string {
+	if isASCIIPrintable(filename) {
+		return fmt.Sprintf(`%s; filename="%s"`, dispositionType, escapeQuoted(filename))
+	}
+	// 不支持filename*的旧客户端会使用filename中的ascii回退
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '_'
+		}
+		return r
+	}, filename)
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`,
+		dispositionType, escapeQuoted(fallback), encodeExtValue(filename))
+}
+
+func isASCIIPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RFC 5987 ext-value编码，attr-char以外的字节都要百分号编码
+func encodeExtValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+func escapeQuoted(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
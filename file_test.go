@@ -0,0 +1,143 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", `attachment; filename="report.pdf"`},
+		{`a "quoted" \name.txt`, `attachment; filename="a \"quoted\" \\name.txt"`},
+		{"报告.pdf", `attachment; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`},
+		{"naïve file.txt", `attachment; filename="na_ve file.txt"; filename*=UTF-8''na%C3%AFve%20file.txt`},
+		{"a\nb.txt", `attachment; filename="a_b.txt"; filename*=UTF-8''a%0Ab.txt`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition("attachment", tt.name); got != tt.want {
+			t.Errorf("contentDisposition(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileAttachment(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine()
+	e.GET("/named", func(ctx *Context) { ctx.FileAttachment(path, "导出.csv") })
+	e.GET("/default", func(ctx *Context) { ctx.FileAttachment(path, "") })
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/named", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "a,b\n1,2\n" {
+		t.Fatalf("status %d, body %q", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="__.csv"; filename*=UTF-8''%E5%AF%BC%E5%87%BA.csv` {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/default", nil))
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="data.csv"` {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+}
+
+func TestFileFromFS(t *testing.T) {
+	fsys := http.FS(fstest.MapFS{
+		"hello.txt": {Data: []byte("hello world")},
+		"dir":       {Mode: os.ModeDir},
+	})
+	e := NewEngine()
+	e.GET("/f", func(ctx *Context) { ctx.FileFromFS(ctx.Query("name"), fsys) })
+
+	tests := []struct {
+		name  string
+		rng   string
+		code  int
+		body  string
+		extra string
+	}{
+		{"hello.txt", "", http.StatusOK, "hello world", ""},
+		{"hello.txt", "bytes=6-", http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{"missing.txt", "", http.StatusNotFound, "404 NOT FOUND", ""},
+		{"dir", "", http.StatusNotFound, "404 NOT FOUND", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/f?name="+tt.name, nil)
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %q: status %d body %q, want %d %q", tt.name, tt.rng, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+		if cr := w.Header().Get("Content-Range"); cr != tt.extra {
+			t.Errorf("%s %q: Content-Range %q, want %q", tt.name, tt.rng, cr, tt.extra)
+		}
+	}
+}
+
+func TestDataFromReader(t *testing.T) {
+	const content = "0123456789"
+	e := NewEngine()
+	e.GET("/seek", func(ctx *Context) {
+		ctx.DataFromReader(http.StatusOK, int64(len(content)), "text/plain", strings.NewReader(content), map[string]string{
+			"ETag":          `"v1"`,
+			"Last-Modified": "Mon, 02 Jan 2006 15:04:05 GMT",
+		})
+	})
+	e.GET("/stream", func(ctx *Context) {
+		// 只实现io.Reader，不支持Range
+		ctx.DataFromReader(http.StatusAccepted, int64(len(content)), "text/plain", readerFunc(strings.NewReader(content).Read), nil)
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		code    int
+		body    string
+	}{
+		{"full", "/seek", nil, http.StatusOK, content},
+		{"range", "/seek", map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "234"},
+		{"unsatisfiable range", "/seek", map[string]string{"Range": "bytes=20-"}, http.StatusRequestedRangeNotSatisfiable, ""},
+		{"If-None-Match hit", "/seek", map[string]string{"If-None-Match": `"v1"`}, http.StatusNotModified, ""},
+		{"If-None-Match miss", "/seek", map[string]string{"If-None-Match": `"v2"`}, http.StatusOK, content},
+		{"If-Modified-Since", "/seek", map[string]string{"If-Modified-Since": "Tue, 03 Jan 2006 00:00:00 GMT"}, http.StatusNotModified, ""},
+		{"If-Range mismatch", "/seek", map[string]string{"Range": "bytes=2-4", "If-Range": `"v2"`}, http.StatusOK, content},
+		{"plain reader ignores Range", "/stream", map[string]string{"Range": "bytes=2-4"}, http.StatusAccepted, content},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.code)
+		}
+		if tt.code != http.StatusRequestedRangeNotSatisfiable && w.Body.String() != tt.body {
+			t.Errorf("%s: body %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+// 把函数包装成只实现io.Reader的类型
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
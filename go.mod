@@ -2,4 +2,12 @@ module github.com/seaung/ex
 
 go 1.24.5
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.36.12
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
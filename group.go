@@ -1,5 +1,10 @@
 package ex
 
+import (
+	"fmt"
+	"strings"
+)
+
 /**
  * 路由分组
  */
@@ -36,38 +41,31 @@ func (rg *RouterGroup) addRoute(method, path string, handlers ...HandlerFunc) {
 }
 
 func (rg *RouterGroup) GET(path string, handlers ...HandlerFunc) {
-	fullPath := rg.prefix + path
-	rg.addRoute("GET", fullPath, handlers...)
+	rg.addRoute("GET", path, handlers...)
 }
 
 func (rg *RouterGroup) POST(path string, handlers ...HandlerFunc) {
-	fullPath := rg.prefix + path
-	rg.addRoute("POST", fullPath, handlers...)
+	rg.addRoute("POST", path, handlers...)
 }
 
 func (rg *RouterGroup) DELETE(path string, handlers ...HandlerFunc) {
-	fullPath := rg.prefix + path
-	rg.addRoute("DELETE", fullPath, handlers...)
+	rg.addRoute("DELETE", path, handlers...)
 }
 
 func (rg *RouterGroup) PUT(path string, handlers ...HandlerFunc) {
-	fullPath := rg.prefix + path
-	rg.addRoute("PUT", fullPath, handlers...)
+	rg.addRoute("PUT", path, handlers...)
 }
 
 func (rg *RouterGroup) OPTIONS(path string, handlers ...HandlerFunc) {
-	fullPath := rg.prefix + path
-	rg.addRoute("OPTIONS", fullPath, handlers...)
+	rg.addRoute("OPTIONS", path, handlers...)
 }
 
 func (rg *RouterGroup) HEAD(path string, handlers ...HandlerFunc) {
-	fullPath := rg.prefix + path
-	rg.addRoute("HEAD", fullPath, handlers...)
+	rg.addRoute("HEAD", path, handlers...)
 }
 
 func (rg *RouterGroup) PATCH(path string, handlers ...HandlerFunc) {
-	fullPath := rg.prefix + path
-	rg.addRoute("PATCH", fullPath, handlers...)
+	rg.addRoute("PATCH", path, handlers...)
 }
 
 func (rg *RouterGroup) Any(path string, handlers ...HandlerFunc) {
@@ -76,3 +74,19 @@ func (rg *RouterGroup) Any(path string, handlers ...HandlerFunc) {
 		rg.addRoute(method, path, handlers...)
 	}
 }
+
+// 给路由命名，之后可以通过Engine.URL和Context.RedirectToRoute生成地址
+// 路由只做精确匹配，所以path中不能有:name参数，*name只能作为最后一段(例如Static注册的/*filepath)
+func (rg *RouterGroup) Name(name, path string) {
+	fullPath := rg.prefix + path
+	segments := strings.Split(fullPath, "/")
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			panic(fmt.Sprintf("ex: route %q: path params are not supported in %q", name, fullPath))
+		case strings.HasPrefix(seg, "*") && i != len(segments)-1:
+			panic(fmt.Sprintf("ex: route %q: %q must be the last segment of %q", name, seg, fullPath))
+		}
+	}
+	rg.engine.router.names[name] = fullPath
+}
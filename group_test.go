@@ -0,0 +1,33 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroupRoutePrefix(t *testing.T) {
+	e := NewEngine()
+	api := e.AddGroup("/api")
+	api.GET("/hello", func(ctx *Context) { ctx.String(http.StatusOK, "hello") })
+	v1 := api.AddGroup("/v1")
+	v1.POST("/users", func(ctx *Context) { ctx.String(http.StatusOK, "users") })
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodGet, "/api/hello", http.StatusOK},
+		{http.MethodPost, "/api/v1/users", http.StatusOK},
+		{http.MethodGet, "/api/api/hello", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/api/v1/users", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+	}
+}
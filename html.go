@@ -0,0 +1,249 @@
+package ex
+
+/*
+ * html模板渲染
+ * 支持glob，文件列表和fs.FS(embed.FS)三种加载方式
+ * 设置布局后每个页面会单独和布局以及公共片段组合，页面通过define覆盖布局中的block
+ */
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+const htmlContentType = "text/html; charset=utf-8"
+
+var errNoTemplates = errors.New("html templates not loaded")
+
+// 模板加载器，保存加载参数，调试模式下每次请求都会重新加载
+type htmlLoader struct {
+	fsys    fs.FS
+	pages   []string
+	glob    bool
+	layout  []string
+	funcMap template.FuncMap
+	delims  [2]string
+}
+
+// 已经解析好的模板
+type htmlTemplates struct {
+	// 没有布局时所有模板在同一个集合中
+	set *template.Template
+	// 有布局时每个页面一个模板集合
+	pages      map[string]*template.Template
+	layoutName string
+}
+
+// 列出匹配的文件
+func (l *htmlLoader) files(patterns []string, glob bool) ([]string, error) {
+	if !glob {
+		return patterns, nil
+	}
+	var files []string
+	for _, pattern := range patterns {
+		var (
+			matches []string
+			err     error
+		)
+		if l.fsys != nil {
+			matches, err = fs.Glob(l.fsys, pattern)
+		} else {
+			matches, err = filepath.Glob(pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("html/template: pattern matches no files: %#q", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func (l *htmlLoader) readFile(name string) ([]byte, error) {
+	if l.fsys != nil {
+		return fs.ReadFile(l.fsys, name)
+	}
+	return os.ReadFile(name)
+}
+
+func (l *htmlLoader) baseName(name string) string {
+	if l.fsys != nil {
+		return path.Base(name)
+	}
+	return filepath.Base(name)
+}
+
+// 把files解析到t中，模板名为文件名
+func (l *htmlLoader) parseFiles(t *template.Template, files []string) (*template.Template, error) {
+	for _, file := range files {
+		b, err := l.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := l.baseName(file)
+		var tmpl *template.Template
+		if t == nil {
+			t = l.newTemplate(name)
+		}
+		if name == t.Name() {
+			tmpl = t
+		} else {
+			tmpl = t.New(name)
+		}
+		if _, err := tmpl.Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (l *htmlLoader) newTemplate(name string) *template.Template {
+	return template.New(name).Delims(l.delims[0], l.delims[1]).Funcs(l.funcMap)
+}
+
+func (l *htmlLoader) load() (*htmlTemplates, error) {
+	pages, err := l.files(l.pages, l.glob)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("html/template: no files named")
+	}
+
+	if len(l.layout) == 0 {
+		set, err := l.parseFiles(nil, pages)
+		if err != nil {
+			return nil, err
+		}
+		return &htmlTemplates{set: set}, nil
+	}
+
+	layoutFiles, err := l.files(l.layout, true)
+	if err != nil {
+		return nil, err
+	}
+	base, err := l.parseFiles(nil, layoutFiles)
+	if err != nil {
+		return nil, err
+	}
+	tmpls := &htmlTemplates{
+		pages:      make(map[string]*template.Template, len(pages)),
+		layoutName: base.Name(),
+	}
+	for _, page := range pages {
+		t, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if t, err = l.parseFiles(t, []string{page}); err != nil {
+			return nil, err
+		}
+		tmpls.pages[l.baseName(page)] = t
+	}
+	return tmpls, nil
+}
+
+// 执行名为name的模板
+func (t *htmlTemplates) execute(w io.Writer, name string, data any) error {
+	if t.pages == nil {
+		return t.set.ExecuteTemplate(w, name, data)
+	}
+	page, ok := t.pages[name]
+	if !ok {
+		return fmt.Errorf("html/template: no page template %q", name)
+	}
+	return page.ExecuteTemplate(w, t.layoutName, data)
+}
+
+type htmlRender struct {
+	templates *htmlTemplates
+	name      string
+	data      any
+}
+
+func (r htmlRender) ContentType() string { return htmlContentType }
+
+func (r htmlRender) Render(w io.Writer) error {
+	return r.templates.execute(w, r.name, r.data)
+}
+
+// 设置模板函数，需要在加载模板之前调用
+func (e *Engine) SetFuncMap(funcMap template.FuncMap) {
+	e.html.funcMap = funcMap
+}
+
+// 设置模板分隔符，需要在加载模板之前调用
+func (e *Engine) Delims(left, right string) {
+	e.html.delims = [2]string{left, right}
+}
+
+// 设置布局模板和公共片段，参数为glob模式，第一个匹配的文件是布局
+// 需要在加载模板之前调用，页面通过{{define}}覆盖布局中的{{block}}
+func (e *Engine) SetHTMLLayout(layout string, partials ...string) {
+	e.html.layout = append([]string{layout}, partials...)
+}
+
+// 按glob模式加载模板
+func (e *Engine) LoadHTMLGlob(pattern string) error {
+	e.html.fsys = nil
+	e.html.pages = []string{pattern}
+	e.html.glob = true
+	return e.loadHTML()
+}
+
+// 加载指定的模板文件
+func (e *Engine) LoadHTMLFiles(files ...string) error {
+	e.html.fsys = nil
+	e.html.pages = files
+	e.html.glob = false
+	return e.loadHTML()
+}
+
+// 从fs.FS中加载模板，可以配合embed.FS使用，布局也从fsys中查找
+func (e *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) error {
+	e.html.fsys = fsys
+	e.html.pages = patterns
+	e.html.glob = true
+	return e.loadHTML()
+}
+
+func (e *Engine) loadHTML() error {
+	tmpls, err := e.html.load()
+	if err != nil {
+		return err
+	}
+	e.htmlTemplates = tmpls
+	return nil
+}
+
+// 获取模板，调试模式下每次都重新解析
+func (e *Engine) templates() (*htmlTemplates, error) {
+	if e.debug && e.html.pages != nil {
+		return e.html.load()
+	}
+	if e.htmlTemplates == nil {
+		return nil, errNoTemplates
+	}
+	return e.htmlTemplates, nil
+}
+
+// 使用名为name的模板响应html
+func (ctx *Context) HTML(code int, name string, data any) {
+	if ctx.engine == nil {
+		ctx.renderError(errNoTemplates)
+		return
+	}
+	tmpls, err := ctx.engine.templates()
+	if err != nil {
+		ctx.renderError(err)
+		return
+	}
+	ctx.Render(code, htmlRender{templates: tmpls, name: name, data: data})
+}
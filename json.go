@@ -0,0 +1,50 @@
+package ex
+
+/*
+ * JSON编解码抽象，默认使用标准库encoding/json
+ * 可以通过Engine.SetJSONCodec替换为json v2或者第三方实现
+ */
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSON编解码接口
+type JSONCodec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	NewEncoder(w io.Writer) JSONEncoder
+	NewDecoder(r io.Reader) JSONDecoder
+}
+
+// JSON流式编码器
+type JSONEncoder interface {
+	Encode(v any) error
+}
+
+// JSON流式解码器
+type JSONDecoder interface {
+	Decode(v any) error
+}
+
+// 基于标准库encoding/json的实现
+type StdJSONCodec struct{}
+
+func (StdJSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (StdJSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (StdJSONCodec) NewEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+func (StdJSONCodec) NewDecoder(r io.Reader) JSONDecoder {
+	return json.NewDecoder(r)
+}
+
+// 未给Engine设置codec时使用的默认实现
+var DefaultJSONCodec JSONCodec = StdJSONCodec{}
@@ -0,0 +1,332 @@
+package ex
+
+/*
+ * JWKS密钥集，从文件或者HTTP地址加载公钥，按kid缓存
+ * 定时刷新，遇到未知kid时在限流范围内立即刷新，刷新失败时继续使用缓存的密钥
+ */
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// 响应体大小上限
+const maxJWKSSize = 1 << 20
+
+type JWKSConfig struct {
+	// JWKS地址，和File二选一
+	URL string
+	// JWKS文件路径
+	File string
+	// 定时刷新间隔，默认1小时，小于0时不定时刷新
+	RefreshInterval time.Duration
+	// 两次刷新之间的最小间隔，用于限制未知kid触发的刷新，默认1分钟
+	MinRefreshInterval time.Duration
+	// 请求JWKS使用的客户端，默认使用超时10秒的http.Client
+	Client *http.Client
+	// 刷新失败时调用，默认通过slog记录
+	ErrorHandler func(err error)
+}
+
+// JWKS中的一个密钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+type jwksKey struct {
+	key any
+	// JWK中声明的alg，不为空时token的alg必须和它一致
+	alg string
+}
+
+// JWKS密钥集，可以赋值给JWTConfig.KeySet
+type JWKS struct {
+	config JWKSConfig
+
+	mu   sync.RWMutex
+	keys map[string]jwksKey
+
+	// 串行化刷新
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// 创建JWKS并立即加载一次，首次加载失败时返回错误
+func NewJWKS(config JWKSConfig) (*JWKS, error) {
+	if (config.URL == "") == (config.File == "") {
+		return nil, errors.New("jwks: exactly one of URL and File must be set")
+	}
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = time.Hour
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = time.Minute
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(err error) {
+			slog.Warn("jwks refresh failed", "error", err)
+		}
+	}
+
+	k := &JWKS{
+		config: config,
+		keys:   make(map[string]jwksKey),
+		done:   make(chan struct{}),
+	}
+	if err := k.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	if config.RefreshInterval > 0 {
+		go k.refreshLoop()
+	}
+	return k, nil
+}
+
+// 停止定时刷新
+func (k *JWKS) Close() {
+	k.closeOnce.Do(func() {
+		close(k.done)
+	})
+}
+
+func (k *JWKS) refreshLoop() {
+	ticker := time.NewTicker(k.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := k.Refresh(context.Background()); err != nil {
+				k.config.ErrorHandler(err)
+			}
+		case <-k.done:
+			return
+		}
+	}
+}
+
+// 重新加载密钥集，失败时保留原来的密钥
+func (k *JWKS) Refresh(ctx context.Context) error {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+	return k.refresh(ctx)
+}
+
+func (k *JWKS) refresh(ctx context.Context) error {
+	k.lastRefresh = time.Now()
+
+	data, err := k.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+func (k *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if k.config.File != "" {
+		return os.ReadFile(k.config.File)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: unexpected status %d from %s", resp.StatusCode, k.config.URL)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// 查找kid对应的验证密钥，alg为token头中的算法
+// kid不存在时在限流范围内刷新一次再查找
+func (k *JWKS) Key(kid, alg string) (any, error) {
+	if key, ok := k.lookup(kid); ok {
+		return key.check(alg)
+	}
+
+	k.refreshMu.Lock()
+	// 等待锁的过程中其他请求可能已经刷新过
+	if key, ok := k.lookup(kid); ok {
+		k.refreshMu.Unlock()
+		return key.check(alg)
+	}
+	if time.Since(k.lastRefresh) >= k.config.MinRefreshInterval {
+		if err := k.refresh(context.Background()); err != nil {
+			k.config.ErrorHandler(err)
+		}
+	}
+	k.refreshMu.Unlock()
+
+	if key, ok := k.lookup(kid); ok {
+		return key.check(alg)
+	}
+	return nil, &jwtError{message: "unknown key id"}
+}
+
+func (k *JWKS) lookup(kid string) (jwksKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if kid == "" {
+		// 没有kid时只有密钥集中只有一个密钥才能确定使用哪个
+		if len(k.keys) == 1 {
+			for _, key := range k.keys {
+				return key, true
+			}
+		}
+		return jwksKey{}, false
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (key jwksKey) check(alg string) (any, error) {
+	if key.alg != "" && key.alg != alg {
+		return nil, errJWTInvalidKey
+	}
+	return key.key, nil
+}
+
+func parseJWKS(data []byte) (map[string]jwksKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := DefaultJSONCodec.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]jwksKey, len(set.Keys))
+	for _, j := range set.Keys {
+		// 跳过用于加密的密钥
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		key, err := j.publicKey()
+		if err != nil {
+			// 不支持的密钥类型不影响其他密钥
+			continue
+		}
+		keys[j.Kid] = jwksKey{key: key, alg: j.Alg}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks: no usable keys")
+	}
+	return keys, nil
+}
+
+func (j *jwk) publicKey() (any, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("jwks: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch j.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("jwks: unsupported curve %q", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("jwks: invalid EC coordinate length")
+		}
+		// 通过ecdh校验点在曲线上
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwks: unsupported curve %q", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwks: invalid Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(j.K)
+	default:
+		return nil, fmt.Errorf("jwks: unsupported key type %q", j.Kty)
+	}
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("jwks: empty integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,307 @@
+package ex
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid, alg string, key *rsa.PublicKey) string {
+	return fmt.Sprintf(`{"kty":"RSA","kid":%q,"alg":%q,"use":"sig","n":%q,"e":%q}`,
+		kid, alg, b64url(key.N.Bytes()), b64url(big.NewInt(int64(key.E)).Bytes()))
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return fmt.Sprintf(`{"kty":"EC","kid":%q,"crv":%q,"x":%q,"y":%q}`,
+		kid, key.Curve.Params().Name, b64url(key.X.FillBytes(make([]byte, size))), b64url(key.Y.FillBytes(make([]byte, size))))
+}
+
+func jwksDoc(keys ...string) string {
+	return `{"keys":[` + strings.Join(keys, ",") + `]}`
+}
+
+// 可以替换响应内容和模拟失败的JWKS服务
+type jwksServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	doc  string
+	fail bool
+	hits atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, doc string) *jwksServer {
+	s := &jwksServer{doc: doc}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(s.doc))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(doc string, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doc, s.fail = doc, fail
+}
+
+func newTestJWKS(t *testing.T, config JWKSConfig) *JWKS {
+	t.Helper()
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(error) {}
+	}
+	ks, err := NewJWKS(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ks.Close)
+	return ks
+}
+
+func TestJWKSFromURL(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	srv := newJWKSServer(t, jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey), ecJWK("e1", &keys.p256.PublicKey)))
+	ks := newTestJWKS(t, JWKSConfig{URL: srv.URL})
+	e := newJWTEngine(JWTConfig{KeySet: ks, Algorithms: []string{"RS256", "ES256"}})
+
+	rs, _ := GenerateTokenWithKey(JWTClaims{Subject: "rsa"}, "RS256", keys.rsa, "r1")
+	es, _ := GenerateTokenWithKey(JWTClaims{Subject: "ec"}, "ES256", keys.p256, "e1")
+	for token, want := range map[string]string{rs: "rsa", es: "ec"} {
+		if w := jwtRequest(e, token); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("got %d %q, want 200 %q", w.Code, w.Body.String(), want)
+		}
+	}
+	if hits := srv.hits.Load(); hits != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", hits)
+	}
+}
+
+func TestJWKSFromFile(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	name := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(name, []byte(jwksDoc(rsaJWK("r1", "", &keys.rsa.PublicKey))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ks := newTestJWKS(t, JWKSConfig{File: name})
+	key, err := ks.Key("r1", "RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keys.rsa.PublicKey.Equal(key) {
+		t.Error("loaded key does not match")
+	}
+}
+
+func TestJWKSUnknownKidRefreshIsRateLimited(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	other := newJWTTestKeys(t)
+	srv := newJWKSServer(t, jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey)))
+	ks := newTestJWKS(t, JWKSConfig{URL: srv.URL, MinRefreshInterval: 50 * time.Millisecond})
+
+	// 刚加载过，未知kid不会触发刷新
+	if _, err := ks.Key("r2", "RS256"); err == nil {
+		t.Fatal("found a key for an unknown kid")
+	}
+	if hits := srv.hits.Load(); hits != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", hits)
+	}
+
+	// 密钥轮换后，超过限流间隔的未知kid会触发一次刷新
+	srv.set(jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey), rsaJWK("r2", "RS256", &other.rsa.PublicKey)), false)
+	time.Sleep(60 * time.Millisecond)
+	key, err := ks.Key("r2", "RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.rsa.PublicKey.Equal(key) {
+		t.Error("rotated key does not match")
+	}
+	if hits := srv.hits.Load(); hits != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", hits)
+	}
+
+	// 限流间隔内大量未知kid只会触发一次刷新
+	time.Sleep(60 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ks.Key(fmt.Sprintf("missing-%d", i), "RS256")
+		}(i)
+	}
+	wg.Wait()
+	if hits := srv.hits.Load(); hits != 3 {
+		t.Errorf("JWKS fetched %d times after 20 unknown kids, want 3", hits)
+	}
+}
+
+func TestJWKSServesCacheWhenRefreshFails(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	srv := newJWKSServer(t, jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey)))
+	var errs atomic.Int32
+	ks := newTestJWKS(t, JWKSConfig{
+		URL:                srv.URL,
+		MinRefreshInterval: time.Millisecond,
+		ErrorHandler:       func(error) { errs.Add(1) },
+	})
+
+	srv.set("", true)
+	if err := ks.Refresh(context.Background()); err == nil {
+		t.Fatal("Refresh succeeded against a failing server")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, err := ks.Key("unknown", "RS256"); err == nil {
+		t.Fatal("found a key for an unknown kid")
+	}
+	if errs.Load() != 1 {
+		t.Errorf("ErrorHandler called %d times, want 1", errs.Load())
+	}
+
+	// 无效的文档也不会替换缓存
+	srv.set(`{"keys":[]}`, false)
+	if err := ks.Refresh(context.Background()); err == nil {
+		t.Fatal("Refresh accepted a key set without usable keys")
+	}
+
+	e := newJWTEngine(JWTConfig{KeySet: ks, Algorithms: []string{"RS256"}})
+	token, _ := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, "RS256", keys.rsa, "r1")
+	if w := jwtRequest(e, token); w.Code != http.StatusOK {
+		t.Errorf("cached key: status %d, want 200", w.Code)
+	}
+}
+
+func TestJWKSScheduledRefresh(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	srv := newJWKSServer(t, jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey)))
+	newTestJWKS(t, JWKSConfig{URL: srv.URL, RefreshInterval: 20 * time.Millisecond})
+
+	deadline := time.Now().Add(time.Second)
+	for srv.hits.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if hits := srv.hits.Load(); hits < 3 {
+		t.Errorf("JWKS fetched %d times, want scheduled refreshes", hits)
+	}
+}
+
+func TestJWKSAlgPin(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	srv := newJWKSServer(t, jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey)))
+	ks := newTestJWKS(t, JWKSConfig{URL: srv.URL})
+
+	if _, err := ks.Key("r1", "RS256"); err != nil {
+		t.Errorf("RS256: %v", err)
+	}
+	// JWK声明了alg时不能用于其他算法
+	if _, err := ks.Key("r1", "PS256"); err != errJWTInvalidKey {
+		t.Errorf("PS256 with a key pinned to RS256: err = %v, want errJWTInvalidKey", err)
+	}
+
+	e := newJWTEngine(JWTConfig{KeySet: ks, Algorithms: []string{"RS256", "PS256"}})
+	token, _ := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, "PS256", keys.rsa, "r1")
+	if w := jwtRequest(e, token); w.Code != http.StatusUnauthorized {
+		t.Errorf("PS256 token: status %d, want 401", w.Code)
+	}
+}
+
+func TestJWKSSingleKeyWithoutKid(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	srv := newJWKSServer(t, jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey)))
+	ks := newTestJWKS(t, JWKSConfig{URL: srv.URL})
+	if _, err := ks.Key("", "RS256"); err != nil {
+		t.Errorf("single key without kid: %v", err)
+	}
+
+	// 有多个密钥时无法确定使用哪个
+	srv.set(jwksDoc(rsaJWK("r1", "RS256", &keys.rsa.PublicKey), ecJWK("e1", &keys.p256.PublicKey)), false)
+	if err := ks.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Key("", "RS256"); err == nil {
+		t.Error("token without kid matched a key set with several keys")
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	offCurve := fmt.Sprintf(`{"kty":"EC","kid":"bad","crv":"P-256","x":%q,"y":%q}`,
+		b64url(keys.p256.X.FillBytes(make([]byte, 32))), b64url(big.NewInt(1).FillBytes(make([]byte, 32))))
+	shortCoord := fmt.Sprintf(`{"kty":"EC","kid":"short","crv":"P-256","x":%q,"y":%q}`,
+		b64url([]byte{1, 2, 3}), b64url([]byte{4, 5, 6}))
+	doc := jwksDoc(
+		ecJWK("p256", &keys.p256.PublicKey),
+		ecJWK("p384", &keys.p384.PublicKey),
+		fmt.Sprintf(`{"kty":"OKP","kid":"ed","crv":"Ed25519","x":%q}`, b64url(keys.edPub)),
+		`{"kty":"oct","kid":"hmac","k":"c2VjcmV0"}`,
+		offCurve,
+		shortCoord,
+		`{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}`,
+		`{"kty":"RSA","kid":"badexp","n":"AQAB","e":""}`,
+		`{"kty":"OKP","kid":"x25519","crv":"X25519","x":"AAAA"}`,
+		`{"kty":"unknown","kid":"what"}`,
+	)
+
+	parsed, err := parseJWKS([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []string{"p256", "p384", "ed", "hmac"} {
+		if _, ok := parsed[kid]; !ok {
+			t.Errorf("key %q was not loaded", kid)
+		}
+	}
+	for _, kid := range []string{"bad", "short", "enc", "badexp", "x25519", "what"} {
+		if _, ok := parsed[kid]; ok {
+			t.Errorf("invalid or unsupported key %q was loaded", kid)
+		}
+	}
+	if !keys.p256.PublicKey.Equal(parsed["p256"].key) {
+		t.Error("P-256 key does not match")
+	}
+
+	if _, err := parseJWKS([]byte(jwksDoc(offCurve))); err == nil {
+		t.Error("key set with only invalid keys was accepted")
+	}
+	if _, err := parseJWKS([]byte("not json")); err == nil {
+		t.Error("invalid JSON was accepted")
+	}
+}
+
+func TestNewJWKSErrors(t *testing.T) {
+	if _, err := NewJWKS(JWKSConfig{}); err == nil {
+		t.Error("NewJWKS accepted a config without URL or File")
+	}
+	if _, err := NewJWKS(JWKSConfig{URL: "http://a", File: "b"}); err == nil {
+		t.Error("NewJWKS accepted both URL and File")
+	}
+	srv := newJWKSServer(t, "")
+	srv.set("", true)
+	if _, err := NewJWKS(JWKSConfig{URL: srv.URL}); err == nil {
+		t.Error("NewJWKS succeeded although the first load failed")
+	}
+}
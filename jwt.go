@@ -0,0 +1,385 @@
+package ex
+
+/*
+ * JWT认证中间件
+ */
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type JWTConfig struct {
+	// HMAC算法(HS256等)使用的密钥
+	Secret string
+	// token的来源，多个来源用逗号分隔，按顺序查找，默认"header:Authorization"
+	// 支持header，query，cookie和form，例如"header:Authorization,cookie:jwt,form:token"
+	TokenLookup string
+	// header来源使用的认证方案，默认Bearer
+	AuthScheme string
+	ContextKey string
+	// 自定义获取token的方法，设置后忽略TokenLookup
+	TokenExtractor func(*Context) (string, error)
+	// 返回true时跳过认证，用于受保护分组中的公开路由
+	Skipper func(*Context) bool
+	// 按kid查找的验证密钥，值为[]byte或者公钥(*rsa.PublicKey，*ecdsa.PublicKey，ed25519.PublicKey)
+	// token带有kid时必须能在这里找到对应的密钥
+	Keys map[string]any
+	// token没有kid时使用的验证密钥，为空时使用Secret
+	Key any
+	// JWKS密钥集，设置后按kid从密钥集中查找验证密钥，优先于Keys和Key
+	KeySet *JWKS
+	// 允许的算法，默认只允许HS256，alg不在列表中的token会被拒绝
+	Algorithms []string
+	// 要求的签发者，不为空时iss必须相等
+	Issuer string
+	// 要求的受众，不为空时aud中必须包含它
+	Audience string
+	// 校验exp，nbf和iat时允许的时钟偏差
+	Leeway time.Duration
+	// token的最长有效期，按iat计算，大于0时要求token必须带有iat
+	MaxAge time.Duration
+}
+
+// RFC 7519中的标准声明，自定义声明结构体可以嵌入它
+//
+//	type UserClaims struct {
+//		ex.JWTClaims
+//		Role string `json:"role"`
+//	}
+type JWTClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// aud声明，可以是单个字符串或者字符串数组，只有一个值时编码为字符串
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// JWT认证中间件，T为声明的类型，可以是JWTClaims或者嵌入了JWTClaims的结构体
+//
+//	engine.Use(ex.JWT[ex.JWTClaims](config))
+func JWT[T any](config JWTConfig) HandlerFunc {
+	if config.TokenLookup == "" {
+		config.TokenLookup = "header:Authorization"
+	}
+	if config.AuthScheme == "" {
+		config.AuthScheme = "Bearer"
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{"HS256"}
+	}
+
+	extractor := config.TokenExtractor
+	if extractor == nil {
+		extractor = newTokenExtractor(config.TokenLookup, config.AuthScheme)
+	}
+
+	return func(ctx *Context) {
+		if config.Skipper != nil && config.Skipper(ctx) {
+			ctx.Next()
+			return
+		}
+
+		tokenStr, err := extractor(ctx)
+		if err == nil && tokenStr == "" {
+			err = errJWTMissing
+		}
+		if err != nil {
+			ctx.Status(http.StatusUnauthorized)
+			ctx.String(http.StatusUnauthorized, err.Error())
+			ctx.Abort()
+			return
+		}
+
+		claims, err := parseClaims[T](tokenStr, &config, ctx.JSONCodec())
+		if err != nil {
+			ctx.Status(http.StatusUnauthorized)
+			ctx.String(http.StatusUnauthorized, err.Error())
+			ctx.Abort()
+			return
+		}
+
+		ctx.Req = ctx.Req.WithContext(setValue(ctx.Req.Context(), config.ContextKey, claims))
+		ctx.Next()
+	}
+}
+
+// 验证签名并解码声明，再校验标准声明
+func parseClaims[T any](tokenStr string, config *JWTConfig, codec JSONCodec) (*T, error) {
+	payload, err := parseToken(tokenStr, config, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := new(T)
+	if err := codec.Unmarshal(payload, claims); err != nil {
+		return nil, &jwtError{message: "invalid payload format"}
+	}
+
+	// 标准声明总是单独解码，T中的同名字段(例如自定义的exp)不会影响校验
+	std := new(JWTClaims)
+	if err := codec.Unmarshal(payload, std); err != nil {
+		return nil, &jwtError{message: "invalid payload format"}
+	}
+	if err := config.validateClaims(std, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// 校验标准声明
+func (config *JWTConfig) validateClaims(claims *JWTClaims, now time.Time) error {
+	if claims.ExpiresAt > 0 && now.After(time.Unix(claims.ExpiresAt, 0).Add(config.Leeway)) {
+		return &jwtError{message: "token expired"}
+	}
+	if claims.NotBefore > 0 && now.Add(config.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return &jwtError{message: "token not valid yet"}
+	}
+	if claims.IssuedAt > 0 && now.Add(config.Leeway).Before(time.Unix(claims.IssuedAt, 0)) {
+		return &jwtError{message: "token issued in the future"}
+	}
+	if config.MaxAge > 0 {
+		if claims.IssuedAt <= 0 {
+			return &jwtError{message: "missing iat"}
+		}
+		if now.After(time.Unix(claims.IssuedAt, 0).Add(config.MaxAge + config.Leeway)) {
+			return &jwtError{message: "token expired"}
+		}
+	}
+	if config.Issuer != "" && claims.Issuer != config.Issuer {
+		return &jwtError{message: "invalid issuer"}
+	}
+	if config.Audience != "" && !slices.Contains(claims.Audience, config.Audience) {
+		return &jwtError{message: "invalid audience"}
+	}
+	return nil
+}
+
+var errJWTMissing = &jwtError{message: "missing or malformed jwt"}
+
+type tokenSource struct {
+	kind string
+	name string
+}
+
+// 解析TokenLookup，返回按顺序查找token的方法，格式错误时panic
+func newTokenExtractor(lookup, authScheme string) func(*Context) (string, error) {
+	var sources []tokenSource
+	for _, part := range strings.Split(lookup, ",") {
+		kind, name, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			panic("ex: invalid jwt token lookup " + strconv.Quote(part))
+		}
+		switch kind {
+		case "header", "query", "cookie", "form":
+		default:
+			panic("ex: unsupported jwt token source " + strconv.Quote(kind))
+		}
+		sources = append(sources, tokenSource{kind: kind, name: name})
+	}
+
+	return func(ctx *Context) (string, error) {
+		for _, source := range sources {
+			if token := source.extract(ctx, authScheme); token != "" {
+				return token, nil
+			}
+		}
+		return "", errJWTMissing
+	}
+}
+
+func (source tokenSource) extract(ctx *Context, authScheme string) string {
+	switch source.kind {
+	case "header":
+		auth := ctx.Req.Header.Get(source.name)
+		if auth == "" || authScheme == "" {
+			return auth
+		}
+		// 认证方案不区分大小写
+		scheme, token, ok := strings.Cut(auth, " ")
+		if !ok || !strings.EqualFold(scheme, authScheme) {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	case "query":
+		return ctx.Query(source.name)
+	case "cookie":
+		token, _ := ctx.Cookie(source.name)
+		return token
+	case "form":
+		return ctx.Req.PostFormValue(source.name)
+	default:
+		return ""
+	}
+}
+
+// 验证token的签名，返回payload
+func parseToken(tokenStr string, config *JWTConfig, codec JSONCodec) ([]byte, error) {
+	parts := strings.Split(tokenStr, ".")
+	if len(parts) != 3 {
+		return nil, &jwtError{message: "invalid token format"}
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, &jwtError{message: "invalid header encoding"}
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := codec.Unmarshal(headerBytes, &header); err != nil {
+		return nil, &jwtError{message: "invalid header format"}
+	}
+
+	// 只接受配置中允许的算法，防止none以及算法混淆攻击
+	if !slices.Contains(config.Algorithms, header.Alg) {
+		return nil, &jwtError{message: "unsupported algorithm"}
+	}
+	method := GetJWTSigningMethod(header.Alg)
+	if method == nil {
+		return nil, &jwtError{message: "unsupported algorithm"}
+	}
+
+	key, err := config.verifyKey(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, &jwtError{message: "invalid signature encoding"}
+	}
+	if err := method.Verify(parts[0]+"."+parts[1], signature, key); err != nil {
+		return nil, err
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, &jwtError{message: "invalid payload encoding"}
+	}
+
+	return payloadBytes, nil
+}
+
+// 查找验证签名的密钥
+func (config *JWTConfig) verifyKey(kid, alg string) (any, error) {
+	if config.KeySet != nil {
+		return config.KeySet.Key(kid, alg)
+	}
+	if kid != "" && config.Keys != nil {
+		key, ok := config.Keys[kid]
+		if !ok {
+			return nil, &jwtError{message: "unknown key id"}
+		}
+		return key, nil
+	}
+	if config.Key != nil {
+		return config.Key, nil
+	}
+	if config.Secret != "" {
+		return []byte(config.Secret), nil
+	}
+	return nil, &jwtError{message: "no key to verify token"}
+}
+
+// 使用HS256签名生成token
+func GenerateToken[T any](claims T, secret string) (string, error) {
+	return GenerateTokenWithKey(claims, "HS256", []byte(secret), "")
+}
+
+// 使用指定的算法和密钥生成token，key为[]byte(HMAC)或者私钥，kid不为空时写入JWT头
+func GenerateTokenWithKey[T any](claims T, alg string, key any, kid string) (string, error) {
+	method := GetJWTSigningMethod(alg)
+	if method == nil {
+		return "", &jwtError{message: "unsupported algorithm"}
+	}
+
+	header := map[string]interface{}{
+		"alg": alg,
+		"typ": "JWT",
+	}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	headerBytes, err := DefaultJSONCodec.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	payloadBytes, err := DefaultJSONCodec.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	headerEncoded := base64.RawURLEncoding.EncodeToString(headerBytes)
+	payloadEncoded := base64.RawURLEncoding.EncodeToString(payloadBytes)
+
+	signingInput := headerEncoded + "." + payloadEncoded
+	signature, err := method.Sign(signingInput, key)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+type jwtError struct {
+	message string
+}
+
+func (e *jwtError) Error() string {
+	return e.message
+}
+
+type contextKey string
+
+func setValue(ctx context.Context, key string, value interface{}) context.Context {
+	return context.WithValue(ctx, contextKey(key), value)
+}
+
+// 获取JWT中间件解析出的声明，T必须和中间件的类型参数一致
+func GetJWTClaims[T any](ctx *Context, key string) *T {
+	if key == "" {
+		key = "user"
+	}
+	if claims, ok := ctx.Req.Context().Value(contextKey(key)).(*T); ok {
+		return claims
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package ex
+
+/*
+ * JWT签名算法，每个alg对应一个JWTSigningMethod
+ * 验证时密钥类型必须和算法匹配，防止用公钥作为HMAC密钥的算法混淆攻击
+ */
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"math/big"
+	"sync"
+)
+
+var (
+	errJWTInvalidKey       = &jwtError{message: "invalid key type for algorithm"}
+	errJWTInvalidSignature = &jwtError{message: "invalid signature"}
+)
+
+// JWT签名算法
+type JWTSigningMethod interface {
+	// 算法名，对应JWT头中的alg
+	Alg() string
+	// 验证签名，key为[]byte(HMAC)或者公钥
+	Verify(signingInput string, signature []byte, key any) error
+	// 生成签名，key为[]byte(HMAC)或者私钥
+	Sign(signingInput string, key any) ([]byte, error)
+}
+
+var (
+	signingMethodsMu sync.RWMutex
+	signingMethods   = make(map[string]JWTSigningMethod)
+)
+
+// 注册签名算法，已经存在的同名算法会被替换
+func RegisterJWTSigningMethod(m JWTSigningMethod) {
+	signingMethodsMu.Lock()
+	defer signingMethodsMu.Unlock()
+	signingMethods[m.Alg()] = m
+}
+
+// 根据alg获取签名算法
+func GetJWTSigningMethod(alg string) JWTSigningMethod {
+	signingMethodsMu.RLock()
+	defer signingMethodsMu.RUnlock()
+	return signingMethods[alg]
+}
+
+func init() {
+	RegisterJWTSigningMethod(&jwtHMAC{alg: "HS256", hash: crypto.SHA256})
+	RegisterJWTSigningMethod(&jwtHMAC{alg: "HS384", hash: crypto.SHA384})
+	RegisterJWTSigningMethod(&jwtHMAC{alg: "HS512", hash: crypto.SHA512})
+	RegisterJWTSigningMethod(&jwtRSA{alg: "RS256", hash: crypto.SHA256})
+	RegisterJWTSigningMethod(&jwtRSA{alg: "RS384", hash: crypto.SHA384})
+	RegisterJWTSigningMethod(&jwtRSA{alg: "RS512", hash: crypto.SHA512})
+	RegisterJWTSigningMethod(&jwtRSA{alg: "PS256", hash: crypto.SHA256, pss: true})
+	RegisterJWTSigningMethod(&jwtRSA{alg: "PS384", hash: crypto.SHA384, pss: true})
+	RegisterJWTSigningMethod(&jwtRSA{alg: "PS512", hash: crypto.SHA512, pss: true})
+	RegisterJWTSigningMethod(&jwtECDSA{alg: "ES256", hash: crypto.SHA256, keySize: 32})
+	RegisterJWTSigningMethod(&jwtECDSA{alg: "ES384", hash: crypto.SHA384, keySize: 48})
+	RegisterJWTSigningMethod(&jwtECDSA{alg: "ES512", hash: crypto.SHA512, keySize: 66})
+	RegisterJWTSigningMethod(jwtEdDSA{})
+}
+
+func hashSum(hash crypto.Hash, data string) []byte {
+	h := hash.New()
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+type jwtHMAC struct {
+	alg  string
+	hash crypto.Hash
+}
+
+func (m *jwtHMAC) Alg() string { return m.alg }
+
+func (m *jwtHMAC) Sign(signingInput string, key any) ([]byte, error) {
+	secret, ok := key.([]byte)
+	if !ok {
+		return nil, errJWTInvalidKey
+	}
+	h := hmac.New(m.hash.New, secret)
+	h.Write([]byte(signingInput))
+	return h.Sum(nil), nil
+}
+
+func (m *jwtHMAC) Verify(signingInput string, signature []byte, key any) error {
+	expected, err := m.Sign(signingInput, key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(signature, expected) {
+		return errJWTInvalidSignature
+	}
+	return nil
+}
+
+type jwtRSA struct {
+	alg  string
+	hash crypto.Hash
+	pss  bool
+}
+
+func (m *jwtRSA) Alg() string { return m.alg }
+
+func (m *jwtRSA) Sign(signingInput string, key any) ([]byte, error) {
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errJWTInvalidKey
+	}
+	digest := hashSum(m.hash, signingInput)
+	if m.pss {
+		return rsa.SignPSS(rand.Reader, priv, m.hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	return rsa.SignPKCS1v15(rand.Reader, priv, m.hash, digest)
+}
+
+func (m *jwtRSA) Verify(signingInput string, signature []byte, key any) error {
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return errJWTInvalidKey
+	}
+	digest := hashSum(m.hash, signingInput)
+	var err error
+	if m.pss {
+		err = rsa.VerifyPSS(pub, m.hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	} else {
+		err = rsa.VerifyPKCS1v15(pub, m.hash, digest, signature)
+	}
+	if err != nil {
+		return errJWTInvalidSignature
+	}
+	return nil
+}
+
+// JWS中ECDSA签名是定长的R||S，不是ASN.1格式
+type jwtECDSA struct {
+	alg     string
+	hash    crypto.Hash
+	keySize int
+}
+
+func (m *jwtECDSA) Alg() string { return m.alg }
+
+func (m *jwtECDSA) Sign(signingInput string, key any) ([]byte, error) {
+	priv, ok := key.(*ecdsa.PrivateKey)
+	if !ok || (priv.Curve.Params().BitSize+7)/8 != m.keySize {
+		return nil, errJWTInvalidKey
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hashSum(m.hash, signingInput))
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 2*m.keySize)
+	r.FillBytes(sig[:m.keySize])
+	s.FillBytes(sig[m.keySize:])
+	return sig, nil
+}
+
+func (m *jwtECDSA) Verify(signingInput string, signature []byte, key any) error {
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok || (pub.Curve.Params().BitSize+7)/8 != m.keySize {
+		return errJWTInvalidKey
+	}
+	if len(signature) != 2*m.keySize {
+		return errJWTInvalidSignature
+	}
+	r := new(big.Int).SetBytes(signature[:m.keySize])
+	s := new(big.Int).SetBytes(signature[m.keySize:])
+	if !ecdsa.Verify(pub, hashSum(m.hash, signingInput), r, s) {
+		return errJWTInvalidSignature
+	}
+	return nil
+}
+
+type jwtEdDSA struct{}
+
+func (jwtEdDSA) Alg() string { return "EdDSA" }
+
+func (jwtEdDSA) Sign(signingInput string, key any) ([]byte, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok || len(priv) != ed25519.PrivateKeySize {
+		return nil, errJWTInvalidKey
+	}
+	return ed25519.Sign(priv, []byte(signingInput)), nil
+}
+
+func (jwtEdDSA) Verify(signingInput string, signature []byte, key any) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok || len(pub) != ed25519.PublicKeySize {
+		return errJWTInvalidKey
+	}
+	if !ed25519.Verify(pub, []byte(signingInput), signature) {
+		return errJWTInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package ex
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type jwtTestKeys struct {
+	rsa   *rsa.PrivateKey
+	p256  *ecdsa.PrivateKey
+	p384  *ecdsa.PrivateKey
+	p521  *ecdsa.PrivateKey
+	edPub ed25519.PublicKey
+	ed    ed25519.PrivateKey
+}
+
+func newJWTTestKeys(t *testing.T) *jwtTestKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	edPub, ed, _ := ed25519.GenerateKey(rand.Reader)
+	return &jwtTestKeys{rsa: rsaKey, p256: p256, p384: p384, p521: p521, edPub: edPub, ed: ed}
+}
+
+func TestJWTSigningMethodsRoundTrip(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	tests := []struct {
+		alg       string
+		signKey   any
+		verifyKey any
+	}{
+		{"HS256", []byte("secret"), []byte("secret")},
+		{"HS384", []byte("secret"), []byte("secret")},
+		{"HS512", []byte("secret"), []byte("secret")},
+		{"RS256", keys.rsa, &keys.rsa.PublicKey},
+		{"RS384", keys.rsa, &keys.rsa.PublicKey},
+		{"RS512", keys.rsa, &keys.rsa.PublicKey},
+		{"PS256", keys.rsa, &keys.rsa.PublicKey},
+		{"PS384", keys.rsa, &keys.rsa.PublicKey},
+		{"PS512", keys.rsa, &keys.rsa.PublicKey},
+		{"ES256", keys.p256, &keys.p256.PublicKey},
+		{"ES384", keys.p384, &keys.p384.PublicKey},
+		{"ES512", keys.p521, &keys.p521.PublicKey},
+		{"EdDSA", keys.ed, keys.edPub},
+	}
+	for _, tt := range tests {
+		method := GetJWTSigningMethod(tt.alg)
+		if method == nil {
+			t.Fatalf("%s is not registered", tt.alg)
+		}
+		sig, err := method.Sign("header.payload", tt.signKey)
+		if err != nil {
+			t.Fatalf("%s: Sign: %v", tt.alg, err)
+		}
+		if err := method.Verify("header.payload", sig, tt.verifyKey); err != nil {
+			t.Errorf("%s: Verify: %v", tt.alg, err)
+		}
+		if err := method.Verify("header.tampered", sig, tt.verifyKey); err == nil {
+			t.Errorf("%s: Verify accepted a tampered signing input", tt.alg)
+		}
+
+		// 通过中间件验证完整的token
+		token, err := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, tt.alg, tt.signKey, "k1")
+		if err != nil {
+			t.Fatalf("%s: GenerateTokenWithKey: %v", tt.alg, err)
+		}
+		e := newJWTEngine(JWTConfig{Algorithms: []string{tt.alg}, Keys: map[string]any{"k1": tt.verifyKey}})
+		if w := jwtRequest(e, token); w.Code != http.StatusOK || w.Body.String() != "bob" {
+			t.Errorf("%s: got %d %q, want 200 bob", tt.alg, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestJWTSigningMethodRejectsWrongKeyType(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	tests := []struct {
+		alg string
+		key any
+	}{
+		{"HS256", &keys.rsa.PublicKey},
+		{"RS256", []byte("secret")},
+		{"RS256", &keys.p256.PublicKey},
+		{"ES256", &keys.p384.PublicKey},
+		{"ES256", keys.edPub},
+		{"EdDSA", &keys.rsa.PublicKey},
+	}
+	for _, tt := range tests {
+		if err := GetJWTSigningMethod(tt.alg).Verify("header.payload", []byte("sig"), tt.key); err != errJWTInvalidKey {
+			t.Errorf("%s with %T: err = %v, want errJWTInvalidKey", tt.alg, tt.key, err)
+		}
+	}
+}
+
+func TestJWTAlgorithmConfusion(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	pubDER, err := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	// 同时允许RS256和HS256时，用公钥作为HMAC密钥签名的token也必须被拒绝
+	e := newJWTEngine(JWTConfig{Algorithms: []string{"RS256", "HS256"}, Key: &keys.rsa.PublicKey})
+	for _, secret := range [][]byte{pubDER, pubPEM} {
+		token, err := GenerateTokenWithKey(JWTClaims{Subject: "mallory"}, "HS256", secret, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := jwtRequest(e, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("HS256 token signed with the RSA public key: status %d, want 401", w.Code)
+		}
+	}
+
+	legit, _ := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, "RS256", keys.rsa, "")
+	if w := jwtRequest(e, legit); w.Code != http.StatusOK {
+		t.Errorf("RS256 token: status %d, want 200", w.Code)
+	}
+}
+
+func TestJWTRejectsNoneAlgorithm(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory"}`))
+	for _, token := range []string{header + "." + payload + ".", header + "." + payload + ".c2ln"} {
+		for _, algs := range [][]string{nil, {"HS256", "none"}} {
+			e := newJWTEngine(JWTConfig{Secret: "secret", Algorithms: algs})
+			if w := jwtRequest(e, token); w.Code != http.StatusUnauthorized {
+				t.Errorf("alg none with Algorithms %v: status %d, want 401", algs, w.Code)
+			}
+		}
+	}
+}
+
+func TestJWTRejectsAlgorithmNotAllowed(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	token, _ := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, "RS512", keys.rsa, "")
+	e := newJWTEngine(JWTConfig{Algorithms: []string{"RS256"}, Key: &keys.rsa.PublicKey})
+	w := jwtRequest(e, token)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "unsupported algorithm") {
+		t.Errorf("RS512 token with only RS256 allowed: got %d %q", w.Code, w.Body.String())
+	}
+
+	// 默认只允许HS256
+	hs512, _ := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, "HS512", []byte("secret"), "")
+	if w := jwtRequest(newJWTEngine(JWTConfig{Secret: "secret"}), hs512); w.Code != http.StatusUnauthorized {
+		t.Errorf("HS512 token with default Algorithms: status %d, want 401", w.Code)
+	}
+}
+
+func TestJWTKeyID(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	e := newJWTEngine(JWTConfig{
+		Algorithms: []string{"ES256"},
+		Keys:       map[string]any{"a": &keys.p256.PublicKey},
+	})
+	unknown, _ := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, "ES256", keys.p256, "b")
+	if w := jwtRequest(e, unknown); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "unknown key id") {
+		t.Errorf("unknown kid: got %d %q", w.Code, w.Body.String())
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := GenerateTokenWithKey(JWTClaims{Subject: "bob"}, "ES256", other, "a")
+	if w := jwtRequest(e, forged); w.Code != http.StatusUnauthorized {
+		t.Errorf("token signed with another key: status %d, want 401", w.Code)
+	}
+}
+
+// 创建一个使用JWT中间件的引擎，/me返回subject
+func newJWTEngine(config JWTConfig) *Engine {
+	e := NewEngine()
+	e.Use(JWT[JWTClaims](config))
+	e.GET("/me", func(ctx *Context) {
+		ctx.String(http.StatusOK, GetJWTClaims[JWTClaims](ctx, "").Subject)
+	})
+	return e
+}
+
+func jwtRequest(e *Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
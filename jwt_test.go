@@ -0,0 +1,370 @@
+package ex
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roleClaims struct {
+	JWTClaims
+	Role string `json:"role"`
+}
+
+type roleClaimsPtr struct {
+	*JWTClaims
+	Role string `json:"role"`
+}
+
+// 没有嵌入JWTClaims的声明
+type plainClaims struct {
+	Sub  string `json:"sub"`
+	Role string `json:"role"`
+}
+
+func newRoleEngine[T any](config JWTConfig, role func(*T) string) *Engine {
+	e := NewEngine()
+	e.Use(JWT[T](config))
+	e.GET("/me", func(ctx *Context) {
+		ctx.String(http.StatusOK, role(GetJWTClaims[T](ctx, "")))
+	})
+	return e
+}
+
+func TestJWTPointerEmbeddedClaimsWithoutStandardClaims(t *testing.T) {
+	e := NewEngine()
+	e.Use(Recovery())
+	e.Use(JWT[roleClaimsPtr](JWTConfig{Secret: "secret"}))
+	e.GET("/me", func(ctx *Context) {
+		ctx.String(http.StatusOK, GetJWTClaims[roleClaimsPtr](ctx, "").Role)
+	})
+
+	token, err := GenerateToken(map[string]any{"role": "admin"}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := jwtRequest(e, token); w.Code != http.StatusOK || w.Body.String() != "admin" {
+		t.Errorf("got %d %q, want 200 admin", w.Code, w.Body.String())
+	}
+
+	// 嵌入指针时标准声明同样会被校验
+	expired, _ := GenerateToken(map[string]any{"role": "admin", "exp": time.Now().Add(-time.Hour).Unix()}, "secret")
+	if w := jwtRequest(e, expired); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired token: status %d, want 401", w.Code)
+	}
+}
+
+// 自定义的exp字段覆盖了嵌入的JWTClaims.ExpiresAt
+type shadowedExpClaims struct {
+	JWTClaims
+	Exp  json.Number `json:"exp"`
+	Role string      `json:"role"`
+}
+
+func TestJWTShadowedStandardClaims(t *testing.T) {
+	e := newRoleEngine(JWTConfig{Secret: "secret"}, func(c *shadowedExpClaims) string {
+		return c.Role + " " + c.Exp.String()
+	})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid, _ := GenerateToken(map[string]any{"role": "admin", "exp": exp}, "secret")
+	if w := jwtRequest(e, valid); w.Code != http.StatusOK || w.Body.String() != "admin "+strconv.FormatInt(exp, 10) {
+		t.Errorf("valid token: got %d %q", w.Code, w.Body.String())
+	}
+
+	// 嵌入的ExpiresAt解码后为0，校验必须使用单独解码的标准声明
+	expired, _ := GenerateToken(map[string]any{"role": "admin", "exp": time.Now().Add(-time.Hour).Unix()}, "secret")
+	if w := jwtRequest(e, expired); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired token with shadowed exp: status %d, want 401", w.Code)
+	}
+}
+
+func TestJWTCustomClaims(t *testing.T) {
+	now := time.Now().Unix()
+	payload := map[string]any{"sub": "bob", "role": "admin", "exp": now + 60}
+	token, _ := GenerateToken(payload, "secret")
+	expired, _ := GenerateToken(map[string]any{"sub": "bob", "role": "admin", "exp": now - 60}, "secret")
+
+	engines := map[string]*Engine{
+		"embedded": newRoleEngine(JWTConfig{Secret: "secret"}, func(c *roleClaims) string { return c.Role }),
+		"pointer":  newRoleEngine(JWTConfig{Secret: "secret"}, func(c *roleClaimsPtr) string { return c.Role }),
+		"plain":    newRoleEngine(JWTConfig{Secret: "secret"}, func(c *plainClaims) string { return c.Role }),
+	}
+	for name, e := range engines {
+		if w := jwtRequest(e, token); w.Code != http.StatusOK || w.Body.String() != "admin" {
+			t.Errorf("%s: got %d %q, want 200 admin", name, w.Code, w.Body.String())
+		}
+		// 没有嵌入JWTClaims时也会校验exp
+		if w := jwtRequest(e, expired); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expired token status %d, want 401", name, w.Code)
+		}
+	}
+}
+
+func TestJWTClaimsValidation(t *testing.T) {
+	now := time.Now()
+	config := JWTConfig{
+		Secret:   "secret",
+		Issuer:   "https://auth.example.com",
+		Audience: "api",
+		Leeway:   10 * time.Second,
+		MaxAge:   time.Hour,
+	}
+	valid := func() JWTClaims {
+		return JWTClaims{
+			Issuer:    "https://auth.example.com",
+			Subject:   "bob",
+			Audience:  Audience{"web", "api"},
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(time.Minute).Unix(),
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(*JWTClaims)
+		err    string
+	}{
+		{"valid", func(*JWTClaims) {}, ""},
+		{"single audience", func(c *JWTClaims) { c.Audience = Audience{"api"} }, ""},
+		{"expired within leeway", func(c *JWTClaims) { c.ExpiresAt = now.Add(-5 * time.Second).Unix() }, ""},
+		{"expired", func(c *JWTClaims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }, "token expired"},
+		{"not before within leeway", func(c *JWTClaims) { c.NotBefore = now.Add(5 * time.Second).Unix() }, ""},
+		{"not before", func(c *JWTClaims) { c.NotBefore = now.Add(time.Minute).Unix() }, "token not valid yet"},
+		{"issued in the future", func(c *JWTClaims) { c.IssuedAt = now.Add(time.Minute).Unix() }, "token issued in the future"},
+		{"older than MaxAge", func(c *JWTClaims) { c.IssuedAt = now.Add(-2 * time.Hour).Unix() }, "token expired"},
+		{"missing iat with MaxAge", func(c *JWTClaims) { c.IssuedAt = 0 }, "missing iat"},
+		{"wrong issuer", func(c *JWTClaims) { c.Issuer = "https://evil.example.com" }, "invalid issuer"},
+		{"missing issuer", func(c *JWTClaims) { c.Issuer = "" }, "invalid issuer"},
+		{"wrong audience", func(c *JWTClaims) { c.Audience = Audience{"web"} }, "invalid audience"},
+		{"missing audience", func(c *JWTClaims) { c.Audience = nil }, "invalid audience"},
+	}
+	for _, tt := range tests {
+		claims := valid()
+		tt.modify(&claims)
+		err := config.validateClaims(&claims, now)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestJWTIssuerAndAudienceThroughMiddleware(t *testing.T) {
+	e := newJWTEngine(JWTConfig{Secret: "secret", Issuer: "auth", Audience: "api"})
+	ok, _ := GenerateToken(map[string]any{"iss": "auth", "aud": "api", "sub": "bob"}, "secret")
+	if w := jwtRequest(e, ok); w.Code != http.StatusOK || w.Body.String() != "bob" {
+		t.Errorf("string aud: got %d %q", w.Code, w.Body.String())
+	}
+	list, _ := GenerateToken(map[string]any{"iss": "auth", "aud": []string{"web", "api"}, "sub": "bob"}, "secret")
+	if w := jwtRequest(e, list); w.Code != http.StatusOK {
+		t.Errorf("array aud: status %d", w.Code)
+	}
+	bad, _ := GenerateToken(map[string]any{"iss": "auth", "aud": "web", "sub": "bob"}, "secret")
+	if w := jwtRequest(e, bad); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "invalid audience") {
+		t.Errorf("wrong aud: got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestAudienceJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		aud  Audience
+	}{
+		{`"api"`, Audience{"api"}},
+		{`["web","api"]`, Audience{"web", "api"}},
+		{`[]`, Audience{}},
+	}
+	for _, tt := range tests {
+		var aud Audience
+		if err := json.Unmarshal([]byte(tt.json), &aud); err != nil {
+			t.Errorf("%s: %v", tt.json, err)
+			continue
+		}
+		if !reflect.DeepEqual(aud, tt.aud) {
+			t.Errorf("%s: got %v, want %v", tt.json, aud, tt.aud)
+		}
+	}
+	if err := json.Unmarshal([]byte(`1`), new(Audience)); err == nil {
+		t.Error("number accepted as audience")
+	}
+
+	b, _ := json.Marshal(JWTClaims{Audience: Audience{"api"}})
+	if string(b) != `{"aud":"api"}` {
+		t.Errorf("single audience encoded as %s", b)
+	}
+	b, _ = json.Marshal(JWTClaims{Audience: Audience{"web", "api"}})
+	if string(b) != `{"aud":["web","api"]}` {
+		t.Errorf("audience list encoded as %s", b)
+	}
+	b, _ = json.Marshal(JWTClaims{})
+	if string(b) != `{}` {
+		t.Errorf("empty claims encoded as %s", b)
+	}
+}
+
+func TestJWTTokenLookupFallbackOrder(t *testing.T) {
+	e := NewEngine()
+	e.Use(JWT[roleClaims](JWTConfig{
+		Secret:      "secret",
+		TokenLookup: "header:Authorization, cookie:jwt, form:token, query:token",
+	}))
+	handler := func(ctx *Context) {
+		ctx.String(http.StatusOK, GetJWTClaims[roleClaims](ctx, "").Role)
+	}
+	e.GET("/me", handler)
+	e.POST("/me", handler)
+
+	token := func(role string) string {
+		s, err := GenerateToken(roleClaims{Role: role}, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	tests := []struct {
+		name   string
+		header string
+		cookie bool
+		form   bool
+		query  bool
+		code   int
+		want   string
+	}{
+		{"header first", "Bearer " + token("header"), true, true, true, http.StatusOK, "header"},
+		{"cookie when no header", "", true, true, true, http.StatusOK, "cookie"},
+		{"form after cookie", "", false, true, true, http.StatusOK, "form"},
+		{"query last", "", false, false, true, http.StatusOK, "query"},
+		{"wrong scheme falls back", "Basic " + token("header"), true, false, false, http.StatusOK, "cookie"},
+		{"scheme is case insensitive", "bearer " + token("header"), true, false, false, http.StatusOK, "header"},
+		{"missing everywhere", "", false, false, false, http.StatusUnauthorized, errJWTMissing.Error()},
+		{"wrong scheme only", "Basic " + token("header"), false, false, false, http.StatusUnauthorized, errJWTMissing.Error()},
+	}
+	for _, tt := range tests {
+		url := "/me"
+		if tt.query {
+			url += "?token=" + token("query")
+		}
+		method, body := http.MethodGet, strings.NewReader("")
+		if tt.form {
+			method, body = http.MethodPost, strings.NewReader("token="+token("form"))
+		}
+		req := httptest.NewRequest(method, url, body)
+		if tt.form {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if tt.cookie {
+			req.AddCookie(&http.Cookie{Name: "jwt", Value: token("cookie")})
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Body.String() != tt.want {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.code, tt.want)
+		}
+	}
+}
+
+func TestJWTInvalidTokenLookupPanics(t *testing.T) {
+	for _, lookup := range []string{
+		"header",
+		"header:",
+		"body:token",
+		"header:Authorization,,query:token",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("TokenLookup %q did not panic", lookup)
+				}
+			}()
+			JWT[roleClaims](JWTConfig{Secret: "secret", TokenLookup: lookup})
+		}()
+	}
+}
+
+func TestJWTTokenExtractor(t *testing.T) {
+	valid, _ := GenerateToken(roleClaims{Role: "admin"}, "secret")
+	tests := []struct {
+		name      string
+		extractor func(*Context) (string, error)
+		code      int
+		body      string
+	}{
+		{"custom source", func(ctx *Context) (string, error) { return ctx.Req.Header.Get("X-Token"), nil }, http.StatusOK, "admin"},
+		{"extractor error", func(*Context) (string, error) { return "", errors.New("token service unavailable") }, http.StatusUnauthorized, "token service unavailable"},
+		{"empty token", func(*Context) (string, error) { return "", nil }, http.StatusUnauthorized, errJWTMissing.Error()},
+	}
+	for _, tt := range tests {
+		called := false
+		e := NewEngine()
+		e.Use(JWT[roleClaims](JWTConfig{Secret: "secret", TokenExtractor: tt.extractor}))
+		e.GET("/me", func(ctx *Context) {
+			called = true
+			ctx.String(http.StatusOK, GetJWTClaims[roleClaims](ctx, "").Role)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("X-Token", valid)
+		// 设置了TokenExtractor时忽略默认的Authorization头
+		req.Header.Set("Authorization", "Bearer "+valid)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+		if called != (tt.code == http.StatusOK) {
+			t.Errorf("%s: handler called = %v", tt.name, called)
+		}
+	}
+}
+
+func TestJWTSkipper(t *testing.T) {
+	e := NewEngine()
+	api := e.AddGroup("/api")
+	api.Use(JWT[roleClaims](JWTConfig{
+		Secret:  "secret",
+		Skipper: func(ctx *Context) bool { return ctx.Path == "/api/health" },
+	}))
+	api.GET("/health", func(ctx *Context) {
+		if GetJWTClaims[roleClaims](ctx, "") != nil {
+			t.Error("skipped route should not have claims")
+		}
+		ctx.String(http.StatusOK, "ok")
+	})
+	api.GET("/me", func(ctx *Context) {
+		ctx.String(http.StatusOK, GetJWTClaims[roleClaims](ctx, "").Role)
+	})
+	valid, _ := GenerateToken(roleClaims{Role: "admin"}, "secret")
+
+	tests := []struct {
+		path  string
+		token string
+		code  int
+		body  string
+	}{
+		{"/api/health", "", http.StatusOK, "ok"},
+		{"/api/health", "not-a-token", http.StatusOK, "ok"},
+		{"/api/me", "", http.StatusUnauthorized, errJWTMissing.Error()},
+		{"/api/me", valid, http.StatusOK, "admin"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s token %q: got %d %q, want %d %q", tt.path, tt.token, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
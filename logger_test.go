@@ -0,0 +1,139 @@
+package ex
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 保存日志记录的slog.Handler
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+func (h *captureHandler) all() []slog.Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]slog.Record(nil), h.records...)
+}
+
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func TestLoggerRecordsResponse(t *testing.T) {
+	h := &captureHandler{}
+	e := NewEngine()
+	g := e.AddGroup("")
+	g.Use(LoggerWithConfig(LoggerConfig{Logger: slog.New(h), SkipPaths: []string{"/health"}}))
+	g.GET("/missing", func(ctx *Context) {
+		time.Sleep(5 * time.Millisecond)
+		ctx.String(http.StatusNotFound, "no such thing")
+	})
+	g.GET("/broken", func(ctx *Context) {
+		time.Sleep(5 * time.Millisecond)
+		ctx.String(http.StatusInternalServerError, "oops")
+	})
+	g.GET("/ok", func(ctx *Context) {
+		ctx.Json(http.StatusOK, map[string]int{"a": 1})
+	})
+	g.GET("/health", func(ctx *Context) {
+		ctx.String(http.StatusOK, "up")
+	})
+
+	tests := []struct {
+		path  string
+		code  int
+		bytes int64
+		level slog.Level
+		sleep bool
+	}{
+		{"/missing", http.StatusNotFound, int64(len("no such thing")), slog.LevelWarn, true},
+		{"/broken", http.StatusInternalServerError, int64(len("oops")), slog.LevelError, true},
+		{"/ok", http.StatusOK, int64(len(`{"a":1}` + "\n")), slog.LevelInfo, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("User-Agent", "logger-test")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	records := h.all()
+	if len(records) != len(tests) {
+		t.Fatalf("got %d log records, want %d (SkipPaths not honored?)", len(records), len(tests))
+	}
+	for i, tt := range tests {
+		r := records[i]
+		attrs := recordAttrs(r)
+		if r.Level != tt.level {
+			t.Errorf("%s: level %v, want %v", tt.path, r.Level, tt.level)
+		}
+		if got := attrs[LogFieldStatus].Int64(); got != int64(tt.code) {
+			t.Errorf("%s: status %d, want %d", tt.path, got, tt.code)
+		}
+		if got := attrs[LogFieldBytes].Int64(); got != tt.bytes {
+			t.Errorf("%s: bytes %d, want %d", tt.path, got, tt.bytes)
+		}
+		latency := attrs[LogFieldLatency].Duration()
+		if latency <= 0 || tt.sleep && latency < 5*time.Millisecond {
+			t.Errorf("%s: latency %v", tt.path, latency)
+		}
+		if attrs[LogFieldPath].String() != tt.path || attrs[LogFieldMethod].String() != http.MethodGet {
+			t.Errorf("%s: method/path %v %v", tt.path, attrs[LogFieldMethod], attrs[LogFieldPath])
+		}
+		if attrs[LogFieldUserAgent].String() != "logger-test" {
+			t.Errorf("%s: user agent %v", tt.path, attrs[LogFieldUserAgent])
+		}
+	}
+}
+
+func TestLoggerFieldsAndLevel(t *testing.T) {
+	h := &captureHandler{}
+	e := NewEngine()
+	g := e.AddGroup("")
+	g.Use(LoggerWithConfig(LoggerConfig{
+		Logger: slog.New(h),
+		Fields: []string{LogFieldStatus, LogFieldPath},
+		Level:  func(int) slog.Level { return slog.LevelDebug },
+	}))
+	g.GET("/teapot", func(ctx *Context) {
+		ctx.String(http.StatusTeapot, "short and stout")
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/teapot", nil))
+
+	records := h.all()
+	if len(records) != 1 {
+		t.Fatalf("got %d records", len(records))
+	}
+	attrs := recordAttrs(records[0])
+	if len(attrs) != 2 || attrs[LogFieldStatus].Int64() != http.StatusTeapot || attrs[LogFieldPath].String() != "/teapot" {
+		t.Errorf("attrs %v", attrs)
+	}
+	if records[0].Level != slog.LevelDebug {
+		t.Errorf("level %v", records[0].Level)
+	}
+}
@@ -1,337 +1,375 @@
 package ex
 
 import (
-	"context"
-	"crypto/hmac"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
-func Logger() HandlerFunc {
-	return func(ctx *Context) {
-		start := time.Now()
-		log.Printf("[%d] - %s in %v\n", ctx.StatusCode, ctx.Path, time.Since(start))
-	}
+// 日志中可以输出的字段
+const (
+	LogFieldMethod    = "method"
+	LogFieldPath      = "path"
+	LogFieldStatus    = "status"
+	LogFieldBytes     = "bytes"
+	LogFieldLatency   = "latency"
+	LogFieldClientIP  = "client_ip"
+	LogFieldRequestID = "request_id"
+	LogFieldUserAgent = "user_agent"
+)
+
+var defaultLogFields = []string{
+	LogFieldMethod, LogFieldPath, LogFieldStatus, LogFieldBytes,
+	LogFieldLatency, LogFieldClientIP, LogFieldRequestID, LogFieldUserAgent,
 }
 
-func Recovery() HandlerFunc {
-	return func(ctx *Context) {
-		defer func() {
-			if err := recover(); err != nil {
-				log.Println("panic recovered: ", err)
-				ctx.String(http.StatusInternalServerError, "Internal Server Error")
-			}
-		}()
-		ctx.Next()
-	}
+type LoggerConfig struct {
+	// 为空时使用slog.Default()
+	Logger *slog.Logger
+	// 输出的字段，为空时输出全部字段
+	Fields []string
+	// 不记录日志的路径
+	SkipPaths []string
+	// 根据状态码选择日志级别，默认5xx为Error，4xx为Warn，其余为Info
+	Level func(status int) slog.Level
 }
 
-type CORSConfig struct {
-	AllowOrigins     []string
-	AllowMethods     []string
-	AllowHeaders     []string
-	ExposeHeaders    []string
-	AllowCredentials bool
-	MaxAge           int
+func Logger() HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{})
 }
 
-func CORS(config CORSConfig) HandlerFunc {
-	return func(ctx *Context) {
-		origin := ctx.Req.Header.Get("Origin")
-		allowed := false
-		for _, o := range config.AllowOrigins {
-			if o == "*" || o == origin {
-				allowed = true
-				break
-			}
-		}
+// 请求处理完成后输出一条结构化日志
+func LoggerWithConfig(config LoggerConfig) HandlerFunc {
+	if len(config.Fields) == 0 {
+		config.Fields = defaultLogFields
+	}
+	if config.Level == nil {
+		config.Level = defaultLogLevel
+	}
+	skip := make(map[string]bool, len(config.SkipPaths))
+	for _, path := range config.SkipPaths {
+		skip[path] = true
+	}
 
-		if allowed {
-			if len(config.AllowOrigins) == 1 && config.AllowOrigins[0] == "*" {
-				ctx.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-			} else {
-				ctx.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-			}
+	return func(ctx *Context) {
+		if skip[ctx.Path] {
+			ctx.Next()
+			return
 		}
 
-		if len(config.AllowMethods) > 0 {
-			methods := ""
-			for i, m := range config.AllowMethods {
-				if i > 0 {
-					methods += ", "
-				}
-				methods += m
-			}
-			ctx.Writer.Header().Set("Access-Control-Allow-Methods", methods)
-		}
+		start := time.Now()
+		path := ctx.Req.URL.Path
+		ctx.Next()
+		latency := time.Since(start)
 
-		if len(config.AllowHeaders) > 0 {
-			headers := ""
-			for i, h := range config.AllowHeaders {
-				if i > 0 {
-					headers += ", "
-				}
-				headers += h
-			}
-			ctx.Writer.Header().Set("Access-Control-Allow-Headers", headers)
+		status := ctx.StatusCode
+		if status == 0 {
+			status = http.StatusOK
 		}
-
-		if len(config.ExposeHeaders) > 0 {
-			headers := ""
-			for i, h := range config.ExposeHeaders {
-				if i > 0 {
-					headers += ", "
-				}
-				headers += h
+		attrs := make([]slog.Attr, 0, len(config.Fields))
+		for _, field := range config.Fields {
+			switch field {
+			case LogFieldMethod:
+				attrs = append(attrs, slog.String(field, ctx.Method))
+			case LogFieldPath:
+				attrs = append(attrs, slog.String(field, path))
+			case LogFieldStatus:
+				attrs = append(attrs, slog.Int(field, status))
+			case LogFieldBytes:
+				attrs = append(attrs, slog.Int64(field, ctx.ResponseSize()))
+			case LogFieldLatency:
+				attrs = append(attrs, slog.Duration(field, latency))
+			case LogFieldClientIP:
+				attrs = append(attrs, slog.String(field, ctx.RealIP()))
+			case LogFieldRequestID:
+				attrs = append(attrs, slog.String(field, ctx.RequestID()))
+			case LogFieldUserAgent:
+				attrs = append(attrs, slog.String(field, ctx.Req.UserAgent()))
 			}
-			ctx.Writer.Header().Set("Access-Control-Expose-Headers", headers)
-		}
-
-		if config.AllowCredentials {
-			ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		}
 
-		if config.MaxAge > 0 {
-			ctx.Writer.Header().Set("Access-Control-Max-Age", string(rune(config.MaxAge)))
-		}
-
-		if ctx.Method == "OPTIONS" {
-			ctx.Status(http.StatusNoContent)
-			ctx.Abort()
-			return
+		logger := config.Logger
+		if logger == nil {
+			logger = slog.Default()
 		}
+		logger.LogAttrs(ctx.Req.Context(), config.Level(status), "request", attrs...)
+	}
+}
 
-		ctx.Next()
+func defaultLogLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
 	}
 }
 
-func DefaultCORS() HandlerFunc {
-	return CORS(CORSConfig{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		AllowCredentials: true,
-		MaxAge:           86400,
+func Recovery() HandlerFunc {
+	return CustomRecovery(func(ctx *Context, err any) {
+		ctx.String(http.StatusInternalServerError, "Internal Server Error")
 	})
 }
 
-const RequestIDHeader = "X-Request-ID"
-
-func RequestID() HandlerFunc {
+// 恢复panic并记录日志和调用栈，响应还没有发送时调用handle
+// 客户端已经断开时不会再写响应，http.ErrAbortHandler会继续向上panic
+func CustomRecovery(handle func(ctx *Context, err any)) HandlerFunc {
 	return func(ctx *Context) {
-		requestID := ctx.Req.Header.Get(RequestIDHeader)
-		if requestID == "" {
-			requestID = generateRequestID()
-		}
-		ctx.Writer.Header().Set(RequestIDHeader, requestID)
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			ctx.Abort()
+
+			if isBrokenPipe(err) {
+				slog.Warn("client connection lost", "error", err, "method", ctx.Method, "path", ctx.Path)
+				return
+			}
+			slog.Error("panic recovered", "error", err, "method", ctx.Method, "path", ctx.Path, "stack", panicStack())
+			if ctx.Written() {
+				return
+			}
+			handle(ctx, err)
+		}()
 		ctx.Next()
 	}
 }
 
-func generateRequestID() string {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return time.Now().Format("20060102150405")
+// 连接被客户端断开时写响应会返回EPIPE或者ECONNRESET
+func isBrokenPipe(v any) bool {
+	err, ok := v.(error)
+	if !ok {
+		return false
 	}
-	return hex.EncodeToString(bytes)
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
 }
 
-type JWTConfig struct {
-	Secret      string
-	TokenLookup string
-	AuthScheme  string
-	ContextKey  string
+// 获取发生panic处的调用栈，去掉runtime和recover本身的帧
+func panicStack() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
 }
 
-type JWTClaims struct {
-	Issuer    string                 `json:"iss"`
-	Subject   string                 `json:"sub"`
-	Audience  string                 `json:"aud"`
-	ExpiresAt int64                  `json:"exp"`
-	NotBefore int64                  `json:"nbf"`
-	IssuedAt  int64                  `json:"iat"`
-	ID        string                 `json:"jti"`
-	Payload   map[string]interface{} `json:"payload"`
+type CORSConfig struct {
+	// 允许的Origin，支持"*"和"https://*.example.com"形式的子域名通配
+	AllowOrigins []string
+	// 允许的Origin正则表达式，会自动加上^和$匹配整个Origin
+	AllowOriginRegex []string
+	// 自定义Origin检查，返回true表示允许，和AllowOrigins任意一个满足即可
+	AllowOriginFunc func(origin string) bool
+	// 为空时允许GET，HEAD，POST
+	AllowMethods []string
+	// 为空时允许预检请求中申请的所有请求头
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	// 预检结果的缓存秒数，0表示不设置
+	MaxAge int
+	// 是否允许公网页面访问私有网络(Private Network Access)
+	AllowPrivateNetwork bool
 }
 
-type jwtToken struct {
-	Header    map[string]interface{} `json:"header"`
-	Payload   JWTClaims              `json:"payload"`
-	Signature string                 `json:"signature"`
+// 跨域中间件，AllowOriginRegex中有无效的正则表达式时panic，需要处理错误时使用NewCORS
+func CORS(config CORSConfig) HandlerFunc {
+	handler, err := NewCORS(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
 }
 
-func JWT(config JWTConfig) HandlerFunc {
-	if config.TokenLookup == "" {
-		config.TokenLookup = "header:Authorization"
+// 创建跨域中间件，AllowOriginRegex中有无效的正则表达式时返回错误
+func NewCORS(config CORSConfig) (HandlerFunc, error) {
+	allowAll := false
+	for _, o := range config.AllowOrigins {
+		if o == "*" {
+			allowAll = true
+		}
 	}
-	if config.AuthScheme == "" {
-		config.AuthScheme = "Bearer"
+	regexps := make([]*regexp.Regexp, 0, len(config.AllowOriginRegex))
+	for _, expr := range config.AllowOriginRegex {
+		// 不加锚点时https://app\.example\.com也会匹配https://app.example.com.evil.net
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("ex: invalid cors origin regex %q: %w", expr, err)
+		}
+		regexps = append(regexps, re)
+	}
+	isAllowed := func(origin string) bool {
+		for _, o := range config.AllowOrigins {
+			if matchOrigin(o, origin) {
+				return true
+			}
+		}
+		for _, re := range regexps {
+			if re.MatchString(origin) {
+				return true
+			}
+		}
+		return config.AllowOriginFunc != nil && config.AllowOriginFunc(origin)
 	}
-	if config.ContextKey == "" {
-		config.ContextKey = "user"
+
+	allowMethods := config.AllowMethods
+	if len(allowMethods) == 0 {
+		allowMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	methods := strings.Join(allowMethods, ", ")
+	headers := strings.Join(config.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(config.ExposeHeaders, ", ")
+	maxAge := ""
+	if config.MaxAge > 0 {
+		maxAge = strconv.Itoa(config.MaxAge)
 	}
 
 	return func(ctx *Context) {
-		tokenStr := extractToken(ctx, config.TokenLookup, config.AuthScheme)
-		if tokenStr == "" {
-			ctx.Status(http.StatusUnauthorized)
-			ctx.String(http.StatusUnauthorized, "missing or malformed jwt")
-			ctx.Abort()
-			return
+		header := ctx.Writer.Header()
+		origin := ctx.Req.Header.Get("Origin")
+		preflight := ctx.Method == http.MethodOptions &&
+			origin != "" && ctx.Req.Header.Get("Access-Control-Request-Method") != ""
+
+		// 响应会根据Origin变化，需要告诉缓存
+		if !allowAll || config.AllowCredentials {
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
 		}
 
-		claims, err := parseToken(tokenStr, config.Secret)
-		if err != nil {
-			ctx.Status(http.StatusUnauthorized)
-			ctx.String(http.StatusUnauthorized, err.Error())
-			ctx.Abort()
+		if origin == "" || !isAllowed(origin) {
+			if preflight {
+				ctx.Status(http.StatusNoContent)
+				ctx.Abort()
+				return
+			}
+			ctx.Next()
 			return
 		}
 
-		if claims.ExpiresAt > 0 && time.Now().Unix() > claims.ExpiresAt {
-			ctx.Status(http.StatusUnauthorized)
-			ctx.String(http.StatusUnauthorized, "token expired")
-			ctx.Abort()
-			return
+		// 携带凭证时规范不允许使用*，只能回显具体的Origin
+		if allowAll && !config.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
 		}
 
-		if claims.NotBefore > 0 && time.Now().Unix() < claims.NotBefore {
-			ctx.Status(http.StatusUnauthorized)
-			ctx.String(http.StatusUnauthorized, "token not valid yet")
-			ctx.Abort()
+		if !preflight {
+			if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			ctx.Next()
 			return
 		}
 
-		ctx.Req = ctx.Req.WithContext(setValue(ctx.Req.Context(), config.ContextKey, claims))
-		ctx.Next()
-	}
-}
-
-func extractToken(ctx *Context, lookup, authScheme string) string {
-	parts := strings.Split(lookup, ":")
-	if len(parts) != 2 {
-		return ""
-	}
-
-	switch parts[0] {
-	case "header":
-		auth := ctx.Req.Header.Get(parts[1])
-		if auth == "" {
-			return ""
+		header.Set("Access-Control-Allow-Methods", methods)
+		if headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		} else if reqHeaders := ctx.Req.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", reqHeaders)
 		}
-		if authScheme != "" {
-			if strings.HasPrefix(auth, authScheme+" ") {
-				return strings.TrimPrefix(auth, authScheme+" ")
-			}
-			return ""
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
 		}
-		return auth
-	case "query":
-		return ctx.Query(parts[1])
-	default:
-		return ""
-	}
+		if config.AllowPrivateNetwork && ctx.Req.Header.Get("Access-Control-Request-Private-Network") == "true" {
+			header.Set("Access-Control-Allow-Private-Network", "true")
+		}
+		ctx.Status(http.StatusNoContent)
+		ctx.Abort()
+	}, nil
 }
 
-func parseToken(tokenStr, secret string) (*JWTClaims, error) {
-	parts := strings.Split(tokenStr, ".")
-	if len(parts) != 3 {
-		return nil, &jwtError{message: "invalid token format"}
-	}
-
-	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
-	if err != nil {
-		return nil, &jwtError{message: "invalid header encoding"}
-	}
-
-	var header map[string]interface{}
-	if err := json.Unmarshal(headerBytes, &header); err != nil {
-		return nil, &jwtError{message: "invalid header format"}
-	}
-
-	alg, ok := header["alg"].(string)
-	if !ok || alg != "HS256" {
-		return nil, &jwtError{message: "unsupported algorithm"}
-	}
-
-	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
-	if err != nil {
-		return nil, &jwtError{message: "invalid payload encoding"}
-	}
-
-	var claims JWTClaims
-	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		return nil, &jwtError{message: "invalid payload format"}
-	}
-
-	signingInput := parts[0] + "." + parts[1]
-	expectedSig := signHS256(signingInput, secret)
+// 允许任意来源的跨域请求，不允许携带凭证
+func DefaultCORS() HandlerFunc {
+	return CORS(CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Authorization"},
+		MaxAge:       86400,
+	})
+}
 
-	if !hmac.Equal([]byte(parts[2]), []byte(expectedSig)) {
-		return nil, &jwtError{message: "invalid signature"}
-	}
+const RequestIDHeader = "X-Request-ID"
 
-	return &claims, nil
+type RequestIDConfig struct {
+	// 请求头和响应头的名字，默认为X-Request-ID
+	Header string
+	// 生成id的函数，默认为UUIDv4，也可以使用UUIDv7和ULID
+	Generator func() string
+	// 校验客户端传入的id，不通过时重新生成，默认只允许64个字符以内的字母，数字和-_.:
+	Validator func(id string) bool
 }
 
-func signHS256(data, secret string) string {
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write([]byte(data))
-	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+func RequestID() HandlerFunc {
+	return RequestIDWithConfig(RequestIDConfig{})
 }
 
-func GenerateToken(claims JWTClaims, secret string) (string, error) {
-	header := map[string]interface{}{
-		"alg": "HS256",
-		"typ": "JWT",
+// 为每个请求设置id，可以通过ctx.RequestID()获取，并写入响应头
+// id同时保存在请求的context.Context中，RequestIDTransport会把它转发给下游服务
+func RequestIDWithConfig(config RequestIDConfig) HandlerFunc {
+	if config.Header == "" {
+		config.Header = RequestIDHeader
 	}
-
-	headerBytes, err := json.Marshal(header)
-	if err != nil {
-		return "", err
+	if config.Generator == nil {
+		config.Generator = UUIDv4
 	}
-
-	payloadBytes, err := json.Marshal(claims)
-	if err != nil {
-		return "", err
+	if config.Validator == nil {
+		config.Validator = validRequestID
+	}
+	return func(ctx *Context) {
+		requestID := ctx.Req.Header.Get(config.Header)
+		// 客户端传入的id会写进日志，需要校验防止日志注入
+		if requestID == "" || !config.Validator(requestID) {
+			requestID = config.Generator()
+		}
+		ctx.requestID = requestID
+		ctx.requestIDHeader = config.Header
+		ctx.Req = ctx.Req.WithContext(withRequestID(ctx.Req.Context(), requestID, config.Header))
+		ctx.Writer.Header().Set(config.Header, requestID)
+		ctx.Next()
 	}
-
-	headerEncoded := base64.RawURLEncoding.EncodeToString(headerBytes)
-	payloadEncoded := base64.RawURLEncoding.EncodeToString(payloadBytes)
-
-	signingInput := headerEncoded + "." + payloadEncoded
-	signature := signHS256(signingInput, secret)
-
-	return signingInput + "." + signature, nil
-}
-
-type jwtError struct {
-	message string
-}
-
-func (e *jwtError) Error() string {
-	return e.message
-}
-
-type contextKey string
-
-func setValue(ctx context.Context, key string, value interface{}) context.Context {
-	return context.WithValue(ctx, contextKey(key), value)
 }
 
-func GetJWTClaims(ctx *Context, key string) *JWTClaims {
-	if key == "" {
-		key = "user"
+func validRequestID(id string) bool {
+	if len(id) > 64 {
+		return false
 	}
-	if claims, ok := ctx.Req.Context().Value(contextKey(key)).(*JWTClaims); ok {
-		return claims
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
 	}
-	return nil
+	return true
 }
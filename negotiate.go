@@ -0,0 +1,165 @@
+package ex
+
+/*
+ * 内容协商，根据请求的Accept头选择响应格式
+ */
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 常用的MIME类型
+const (
+	MIMEJSON     = "application/json"
+	MIMEXML      = "application/xml"
+	MIMEXML2     = "text/xml"
+	MIMEYAML     = "application/yaml"
+	MIMEYAML2    = "application/x-yaml"
+	MIMETOML     = "application/toml"
+	MIMEMsgPack  = "application/msgpack"
+	MIMEProtoBuf = "application/x-protobuf"
+	MIMEHTML     = "text/html"
+	MIMEPlain    = "text/plain"
+)
+
+// Negotiate的参数
+type Negotiate struct {
+	// 服务端可以提供的MIME类型，按优先级排列
+	Offered []string
+	// 响应数据
+	Data any
+	// 选中text/html时使用的模板名
+	HTMLName string
+	// 选中text/html时传给模板的数据，为空时使用Data
+	HTMLData any
+}
+
+// Accept中的一项
+type acceptRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// 按照Accept头从offered里选择最合适的MIME类型，没有可接受的类型时返回空字符串
+// Accept为空时返回offered中的第一个
+func (ctx *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	accept := ctx.Req.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offered[0]
+	}
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		q := matchAccept(ranges, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// 根据协商结果渲染响应，没有可接受的类型时返回406
+// Data为proto.Message时json使用protojson，选中protobuf时Data必须是proto.Message
+func (ctx *Context) Negotiate(code int, config Negotiate) {
+	format := ctx.NegotiateFormat(config.Offered...)
+	switch format {
+	case "":
+		ctx.String(http.StatusNotAcceptable, "406 NOT ACCEPTABLE")
+	case MIMEJSON:
+		if msg, ok := config.Data.(proto.Message); ok {
+			ctx.Render(code, protobufRender{json: true, data: msg})
+			return
+		}
+		ctx.Json(code, config.Data)
+	case MIMEXML, MIMEXML2:
+		ctx.XML(code, config.Data)
+	case MIMEYAML, MIMEYAML2:
+		ctx.YAML(code, config.Data)
+	case MIMETOML:
+		ctx.TOML(code, config.Data)
+	case MIMEMsgPack:
+		ctx.MsgPack(code, config.Data)
+	case MIMEProtoBuf:
+		msg, ok := config.Data.(proto.Message)
+		if !ok {
+			ctx.renderError(fmt.Errorf("ex: negotiate: %T is not a proto.Message", config.Data))
+			return
+		}
+		ctx.Render(code, protobufRender{data: msg})
+	case MIMEPlain:
+		ctx.Render(code, plainRender{data: config.Data})
+	case MIMEHTML:
+		data := config.HTMLData
+		if data == nil {
+			data = config.Data
+		}
+		ctx.HTML(code, config.HTMLName, data)
+	default:
+		// 提供了Negotiate不支持的类型属于服务端的错误
+		ctx.renderError(fmt.Errorf("ex: negotiate: unsupported format %q", format))
+	}
+}
+
+// 解析Accept头，忽略无法解析的项
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			// 兼容部分客户端发送的单个*
+			if mediaType != "*" {
+				continue
+			}
+			typ, subtype = "*", "*"
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// 返回offer在ranges中最具体的那一项的q值，不匹配时返回0
+func matchAccept(ranges []acceptRange, offer string) float64 {
+	mediaType, _, err := mime.ParseMediaType(offer)
+	if err != nil {
+		return 0
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,122 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	offered := []string{MIMEJSON, MIMEXML, MIMEHTML}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", MIMEJSON},
+		{"application/xml", MIMEXML},
+		{"text/html,application/xml;q=0.9,*/*;q=0.8", MIMEHTML},
+		{"application/json;q=0.5, application/xml", MIMEXML},
+		{"text/*", MIMEHTML},
+		{"*/*", MIMEJSON},
+		{"image/png", ""},
+		{"application/json;q=0", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		ctx := newContext(httptest.NewRecorder(), req)
+		if got := ctx.NegotiateFormat(offered...); got != tt.want {
+			t.Errorf("Accept %q: got %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	e := NewEngine()
+	if err := e.LoadHTMLFS(fstest.MapFS{
+		"user.html": {Data: []byte(`<p>{{.Name}}</p>`)},
+	}, "*.html"); err != nil {
+		t.Fatal(err)
+	}
+	e.GET("/user", func(ctx *Context) {
+		ctx.Negotiate(http.StatusOK, Negotiate{
+			Offered:  []string{MIMEJSON, MIMEXML, MIMEHTML},
+			Data:     map[string]string{"name": "bob"},
+			HTMLName: "user.html",
+			HTMLData: struct{ Name string }{"bob"},
+		})
+	})
+
+	tests := []struct {
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"application/json", http.StatusOK, "application/json", `{"name":"bob"}`},
+		{"text/html", http.StatusOK, "text/html", "<p>bob</p>"},
+		{"image/png", http.StatusNotAcceptable, "", "406"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		req.Header.Set("Accept", tt.accept)
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("Accept %q: status %d, want %d", tt.accept, w.Code, tt.code)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+			t.Errorf("Accept %q: Content-Type %q, want %q", tt.accept, ct, tt.contentType)
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("Accept %q: body %q, want %q", tt.accept, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestNegotiateFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		offered     []string
+		data        any
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"plain without Accept", []string{MIMEPlain}, "hello", "", http.StatusOK, "text/plain; charset=utf-8", "hello"},
+		{"plain formats data", []string{MIMEJSON, MIMEPlain}, 42, "text/plain", http.StatusOK, "text/plain; charset=utf-8", "42"},
+		{"protobuf", []string{MIMEProtoBuf}, wrapperspb.String("hi"), MIMEProtoBuf, http.StatusOK, "application/x-protobuf", "\n\x02hi"},
+		{"protojson", []string{MIMEProtoBuf, MIMEJSON}, wrapperspb.String("hi"), MIMEJSON, http.StatusOK, "application/json; charset=utf-8", `"hi"`},
+		{"protobuf needs proto.Message", []string{MIMEProtoBuf}, "hi", MIMEProtoBuf, http.StatusInternalServerError, "text/plain; charset=utf-8", "not a proto.Message\n"},
+		{"unsupported offered format", []string{"image/png"}, "hi", "image/png", http.StatusInternalServerError, "text/plain; charset=utf-8", "unsupported format \"image/png\"\n"},
+		{"nothing acceptable", []string{MIMEPlain}, "hi", MIMEJSON, http.StatusNotAcceptable, "", "406 NOT ACCEPTABLE"},
+	}
+	for _, tt := range tests {
+		e := NewEngine()
+		e.GET("/", func(ctx *Context) {
+			ctx.Negotiate(http.StatusOK, Negotiate{Offered: tt.offered, Data: tt.data})
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		e.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: Content-Type %q, want %q", tt.name, ct, tt.contentType)
+		}
+		if !strings.HasSuffix(w.Body.String(), tt.body) {
+			t.Errorf("%s: body %q, want suffix %q", tt.name, w.Body.String(), tt.body)
+		}
+	}
+}
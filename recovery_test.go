@@ -0,0 +1,150 @@
+package ex
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// 把slog.Default替换成captureHandler，测试结束后恢复
+func captureDefaultLog(t *testing.T) *captureHandler {
+	h := &captureHandler{}
+	old := slog.Default()
+	slog.SetDefault(slog.New(h))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return h
+}
+
+// 查找指定消息的日志
+func findRecord(h *captureHandler, msg string) (slog.Record, bool) {
+	for _, r := range h.all() {
+		if r.Message == msg {
+			return r, true
+		}
+	}
+	return slog.Record{}, false
+}
+
+type recoveryResult struct {
+	calls   int
+	value   any
+	w       *httptest.ResponseRecorder
+	repanic any
+}
+
+// 在CustomRecovery下执行会panic的handler
+func serveWithRecovery(handler HandlerFunc) *recoveryResult {
+	res := &recoveryResult{w: httptest.NewRecorder()}
+	e := NewEngine()
+	g := e.AddGroup("")
+	g.Use(CustomRecovery(func(ctx *Context, err any) {
+		res.calls++
+		res.value = err
+		ctx.String(http.StatusInternalServerError, fmt.Sprintf("recovered: %v", err))
+	}))
+	g.GET("/panic", handler)
+
+	func() {
+		defer func() { res.repanic = recover() }()
+		e.ServeHTTP(res.w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	}()
+	return res
+}
+
+func TestCustomRecoveryPassesPanicValue(t *testing.T) {
+	h := captureDefaultLog(t)
+	type panicValue struct{ code int }
+	res := serveWithRecovery(func(ctx *Context) {
+		panic(panicValue{code: 7})
+	})
+
+	if res.calls != 1 || res.value != (panicValue{code: 7}) {
+		t.Errorf("handler calls %d value %#v", res.calls, res.value)
+	}
+	if res.w.Code != http.StatusInternalServerError || res.w.Body.String() != "recovered: {7}" {
+		t.Errorf("response %d %q", res.w.Code, res.w.Body.String())
+	}
+	r, ok := findRecord(h, "panic recovered")
+	if !ok || r.Level != slog.LevelError {
+		t.Fatalf("panic not logged at Error: %+v", r)
+	}
+	if stack := recordAttrs(r)["stack"].String(); !strings.Contains(stack, "TestCustomRecoveryPassesPanicValue") {
+		t.Errorf("stack does not point at the panicking handler:\n%s", stack)
+	}
+}
+
+func TestCustomRecoveryAfterWritten(t *testing.T) {
+	captureDefaultLog(t)
+	res := serveWithRecovery(func(ctx *Context) {
+		ctx.String(http.StatusAccepted, "partial")
+		panic("late failure")
+	})
+
+	if res.calls != 0 {
+		t.Errorf("handler called %d times after the response was written", res.calls)
+	}
+	if res.w.Code != http.StatusAccepted || res.w.Body.String() != "partial" {
+		t.Errorf("response %d %q, want the original response only", res.w.Code, res.w.Body.String())
+	}
+}
+
+func TestCustomRecoveryBrokenPipe(t *testing.T) {
+	for _, errno := range []syscall.Errno{syscall.EPIPE, syscall.ECONNRESET} {
+		h := captureDefaultLog(t)
+		opErr := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", errno)}
+		res := serveWithRecovery(func(ctx *Context) {
+			panic(fmt.Errorf("write response: %w", opErr))
+		})
+
+		if res.calls != 0 {
+			t.Errorf("%v: handler called for a lost connection", errno)
+		}
+		r, ok := findRecord(h, "client connection lost")
+		if !ok || r.Level != slog.LevelWarn {
+			t.Errorf("%v: not logged at Warn", errno)
+		}
+		if _, ok := findRecord(h, "panic recovered"); ok {
+			t.Errorf("%v: logged as a panic", errno)
+		}
+	}
+}
+
+func TestCustomRecoveryAbortHandler(t *testing.T) {
+	captureDefaultLog(t)
+	res := serveWithRecovery(func(ctx *Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	if res.calls != 0 {
+		t.Error("handler called for http.ErrAbortHandler")
+	}
+	if err, _ := res.repanic.(error); !errors.Is(err, http.ErrAbortHandler) {
+		t.Errorf("recovered %v, want http.ErrAbortHandler to propagate", res.repanic)
+	}
+}
+
+func TestIsBrokenPipe(t *testing.T) {
+	tests := []struct {
+		v    any
+		want bool
+	}{
+		{syscall.EPIPE, true},
+		{&net.OpError{Op: "write", Err: syscall.ECONNRESET}, true},
+		{fmt.Errorf("wrapped: %w", syscall.EPIPE), true},
+		{errors.New("broken pipe"), false},
+		{"broken pipe", false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isBrokenPipe(tt.v); got != tt.want {
+			t.Errorf("isBrokenPipe(%#v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		code      int
+		location  string
+		wantPanic bool
+	}{
+		{http.StatusMovedPermanently, "/new", false},
+		{http.StatusFound, "https://example.com/x", false},
+		{http.StatusSeeOther, "/done", false},
+		{http.StatusTemporaryRedirect, "/tmp", false},
+		{http.StatusPermanentRedirect, "/perm", false},
+		{http.StatusCreated, "/items/1", false},
+		{http.StatusOK, "/x", true},
+		{http.StatusNotFound, "/x", true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		ctx := newContext(w, httptest.NewRequest(http.MethodGet, "/old", nil))
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			ctx.Redirect(tt.code, tt.location)
+			return false
+		}()
+		if panicked != tt.wantPanic {
+			t.Errorf("Redirect(%d): panicked %v, want %v", tt.code, panicked, tt.wantPanic)
+			continue
+		}
+		if tt.wantPanic {
+			continue
+		}
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Errorf("Redirect(%d, %q): got %d %q", tt.code, tt.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRedirectToRoute(t *testing.T) {
+	e := NewEngine()
+	admin := e.AddGroup("/admin")
+	admin.GET("/dashboard", func(ctx *Context) {})
+	admin.Name("admin.dashboard", "/dashboard")
+	e.Name("assets", "/static/*filepath")
+
+	var redirectErr error
+	handler := func(ctx *Context) {
+		redirectErr = ctx.RedirectToRoute(ctx.Query("to"), map[string]string{
+			"filepath": "css/app 1.css",
+			"tab":      "stats",
+		})
+		if redirectErr != nil {
+			ctx.String(http.StatusInternalServerError, redirectErr.Error())
+		}
+	}
+	e.GET("/go", handler)
+	e.POST("/go", handler)
+
+	tests := []struct {
+		method   string
+		to       string
+		code     int
+		location string
+		err      string
+	}{
+		{http.MethodGet, "admin.dashboard", http.StatusFound, "/admin/dashboard?filepath=css%2Fapp+1.css&tab=stats", ""},
+		{http.MethodPost, "admin.dashboard", http.StatusSeeOther, "/admin/dashboard?filepath=css%2Fapp+1.css&tab=stats", ""},
+		{http.MethodGet, "assets", http.StatusFound, "/static/css/app%201.css?tab=stats", ""},
+		{http.MethodGet, "missing", http.StatusInternalServerError, "", `route "missing" not found`},
+	}
+	for _, tt := range tests {
+		redirectErr = nil
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(tt.method, "/go?to="+tt.to, nil))
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.to, w.Code, w.Header().Get("Location"), tt.code, tt.location)
+		}
+		if tt.err == "" && redirectErr != nil || tt.err != "" && (redirectErr == nil || redirectErr.Error() != tt.err) {
+			t.Errorf("%s %s: err %v, want %q", tt.method, tt.to, redirectErr, tt.err)
+		}
+	}
+
+	if _, err := e.URL("assets", nil); err == nil || !strings.Contains(err.Error(), `missing param "filepath"`) {
+		t.Errorf("URL without params: %v", err)
+	}
+
+	ctx := newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if err := ctx.RedirectToRoute("assets", nil); err == nil {
+		t.Error("RedirectToRoute without engine should return an error")
+	}
+}
+
+func TestNameRejectsUnsupportedPatterns(t *testing.T) {
+	tests := []struct {
+		path      string
+		wantPanic bool
+	}{
+		{"/users", false},
+		{"/files/*filepath", false},
+		{"/users/:id", true},
+		{"/*rest/edit", true},
+	}
+	for _, tt := range tests {
+		e := NewEngine()
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			e.AddGroup("/api").Name("route", tt.path)
+			return false
+		}()
+		if panicked != tt.wantPanic {
+			t.Errorf("Name(%q): panicked %v, want %v", tt.path, panicked, tt.wantPanic)
+		}
+	}
+}
+
+func TestHandleContext(t *testing.T) {
+	e := NewEngine()
+	var calls []string
+	e.Use(func(ctx *Context) {
+		calls = append(calls, "mw "+ctx.Path)
+		ctx.Next()
+	})
+	e.GET("/old", func(ctx *Context) {
+		ctx.Req.URL.Path = "/new"
+		e.HandleContext(ctx)
+	})
+	e.GET("/new", func(ctx *Context) {
+		calls = append(calls, "new "+ctx.Path)
+		ctx.String(http.StatusOK, "moved internally")
+	})
+	e.GET("/to-missing", func(ctx *Context) {
+		ctx.Req.URL.Path = "/nowhere"
+		e.HandleContext(ctx)
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/old", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "moved internally" {
+		t.Errorf("status %d, body %q", w.Code, w.Body.String())
+	}
+	if want := "mw /old,mw /new,new /new"; strings.Join(calls, ",") != want {
+		t.Errorf("calls %v, want %s", calls, want)
+	}
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/to-missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", w.Code)
+	}
+}
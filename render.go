@@ -0,0 +1,308 @@
+package ex
+
+/*
+ * 响应渲染，所有格式的输出都实现Render接口
+ * 由Context.Render统一处理状态码，Content-Type和错误
+ */
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// 渲染接口
+type Render interface {
+	// 响应的Content-Type
+	ContentType() string
+	// 把内容写入w，返回错误时不会有任何内容发送给客户端
+	Render(w io.Writer) error
+}
+
+// 使用r渲染响应，渲染失败时返回500
+func (ctx *Context) Render(code int, r Render) {
+	var buf bytes.Buffer
+	if err := r.Render(&buf); err != nil {
+		ctx.renderError(err)
+		return
+	}
+	ctx.Writer.Header().Set("Content-Type", r.ContentType())
+	ctx.Status(code)
+	if !bodyAllowedForStatus(code) {
+		return
+	}
+	ctx.Writer.Write(buf.Bytes())
+}
+
+// 渲染失败时统一返回500
+func (ctx *Context) renderError(err error) {
+	http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
+}
+
+// 1xx, 204, 304不允许有响应体
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code <= 199:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// 纯文本，[]byte原样输出，其他类型按fmt.Sprint格式化
+type plainRender struct {
+	data any
+}
+
+func (r plainRender) ContentType() string { return plainContentType }
+
+func (r plainRender) Render(w io.Writer) error {
+	if b, ok := r.data.([]byte); ok {
+		_, err := w.Write(b)
+		return err
+	}
+	_, err := fmt.Fprint(w, r.data)
+	return err
+}
+
+const (
+	defaultSecureJSONPrefix = "while(1);"
+
+	plainContentType      = "text/plain; charset=utf-8"
+	jsonContentType       = "application/json; charset=utf-8"
+	javascriptContentType = "application/javascript; charset=utf-8"
+)
+
+// 普通json，会转义html字符
+type jsonRender struct {
+	codec JSONCodec
+	data  any
+}
+
+func (r jsonRender) ContentType() string { return jsonContentType }
+
+func (r jsonRender) Render(w io.Writer) error {
+	return r.codec.NewEncoder(w).Encode(r.data)
+}
+
+// 带缩进的json，方便调试时阅读
+type indentedJSONRender struct {
+	codec JSONCodec
+	data  any
+}
+
+func (r indentedJSONRender) ContentType() string { return jsonContentType }
+
+func (r indentedJSONRender) Render(w io.Writer) error {
+	b, err := r.codec.Marshal(r.data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "    "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// 带防劫持前缀的json
+type secureJSONRender struct {
+	codec  JSONCodec
+	prefix string
+	data   any
+}
+
+func (r secureJSONRender) ContentType() string { return jsonContentType }
+
+func (r secureJSONRender) Render(w io.Writer) error {
+	b, err := r.codec.Marshal(r.data)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, r.prefix); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// jsonp，callback为空时等同于普通json
+type jsonpRender struct {
+	codec    JSONCodec
+	callback string
+	data     any
+}
+
+func (r jsonpRender) ContentType() string {
+	if r.callback == "" {
+		return jsonContentType
+	}
+	return javascriptContentType
+}
+
+func (r jsonpRender) Render(w io.Writer) error {
+	b, err := r.codec.Marshal(r.data)
+	if err != nil {
+		return err
+	}
+	if r.callback == "" {
+		_, err = w.Write(b)
+		return err
+	}
+	// 前面的注释用于防止Rosetta Flash一类的攻击
+	_, err = fmt.Fprintf(w, "/**/ typeof %s === 'function' && %s(%s);", r.callback, r.callback, b)
+	return err
+}
+
+// 只包含ascii字符的json，非ascii字符会转成\uXXXX
+type asciiJSONRender struct {
+	codec JSONCodec
+	data  any
+}
+
+func (r asciiJSONRender) ContentType() string { return jsonContentType }
+
+func (r asciiJSONRender) Render(w io.Writer) error {
+	b, err := r.codec.Marshal(r.data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for len(b) > 0 {
+		c, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if c < utf8.RuneSelf {
+			buf.WriteByte(byte(c))
+			continue
+		}
+		if c > 0xFFFF {
+			// 超出BMP的字符需要拆成utf-16代理对
+			c -= 0x10000
+			fmt.Fprintf(&buf, `\u%04x\u%04x`, 0xD800+(c>>10), 0xDC00+(c&0x3FF))
+			continue
+		}
+		fmt.Fprintf(&buf, `\u%04x`, c)
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// 不转义html字符的json
+type pureJSONRender struct {
+	codec JSONCodec
+	data  any
+}
+
+func (r pureJSONRender) ContentType() string { return jsonContentType }
+
+func (r pureJSONRender) Render(w io.Writer) error {
+	encoder := r.codec.NewEncoder(w)
+	// 第三方的encoder一般也实现了SetEscapeHTML
+	if e, ok := encoder.(interface{ SetEscapeHTML(bool) }); ok {
+		e.SetEscapeHTML(false)
+	}
+	return encoder.Encode(r.data)
+}
+
+const (
+	xmlContentType     = "application/xml; charset=utf-8"
+	yamlContentType    = "application/yaml; charset=utf-8"
+	tomlContentType    = "application/toml; charset=utf-8"
+	msgpackContentType = "application/msgpack"
+)
+
+type xmlRender struct {
+	data any
+}
+
+func (r xmlRender) ContentType() string { return xmlContentType }
+
+func (r xmlRender) Render(w io.Writer) error {
+	return xml.NewEncoder(w).Encode(r.data)
+}
+
+type yamlRender struct {
+	data any
+}
+
+func (r yamlRender) ContentType() string { return yamlContentType }
+
+func (r yamlRender) Render(w io.Writer) (err error) {
+	// yaml.v3遇到无法编码的类型(chan, func等)会panic，转成错误和其他格式保持一致
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("yaml: %v", v)
+		}
+	}()
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(r.data); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+type tomlRender struct {
+	data any
+}
+
+func (r tomlRender) ContentType() string { return tomlContentType }
+
+func (r tomlRender) Render(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(r.data)
+}
+
+type msgpackRender struct {
+	data any
+}
+
+func (r msgpackRender) ContentType() string { return msgpackContentType }
+
+func (r msgpackRender) Render(w io.Writer) error {
+	return msgpack.NewEncoder(w).Encode(r.data)
+}
+
+const (
+	protobufContentType = "application/x-protobuf"
+)
+
+// protobuf，json为true时使用protojson编码
+type protobufRender struct {
+	json bool
+	data proto.Message
+}
+
+func (r protobufRender) ContentType() string {
+	if r.json {
+		return jsonContentType
+	}
+	return protobufContentType
+}
+
+func (r protobufRender) Render(w io.Writer) error {
+	var (
+		b   []byte
+		err error
+	)
+	if r.json {
+		b, err = protojson.Marshal(r.data)
+	} else {
+		b, err = proto.Marshal(r.data)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,185 @@
+package ex
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type renderCase struct {
+	name        string
+	url         string
+	handler     HandlerFunc
+	code        int
+	contentType string
+	body        string
+}
+
+func runRenderCases(t *testing.T, e *Engine, tests []renderCase) {
+	t.Helper()
+	for i, tt := range tests {
+		path := "/r" + string(rune('a'+i))
+		e.GET(path, tt.handler)
+		url := path
+		if tt.url != "" {
+			url += tt.url
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: Content-Type %q, want %q", tt.name, ct, tt.contentType)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: body %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestJSONRenderers(t *testing.T) {
+	data := map[string]string{"html": "<b>&</b>"}
+	runRenderCases(t, NewEngine(), []renderCase{
+		{
+			name:        "Json escapes html",
+			handler:     func(ctx *Context) { ctx.Json(http.StatusOK, data) },
+			code:        http.StatusOK,
+			contentType: jsonContentType,
+			body:        `{"html":"\u003cb\u003e\u0026\u003c/b\u003e"}` + "\n",
+		},
+		{
+			name:        "PureJSON keeps html",
+			handler:     func(ctx *Context) { ctx.PureJSON(http.StatusOK, data) },
+			code:        http.StatusOK,
+			contentType: jsonContentType,
+			body:        `{"html":"<b>&</b>"}` + "\n",
+		},
+		{
+			name:        "IndentedJSON",
+			handler:     func(ctx *Context) { ctx.IndentedJSON(http.StatusCreated, map[string]int{"a": 1}) },
+			code:        http.StatusCreated,
+			contentType: jsonContentType,
+			body:        "{\n    \"a\": 1\n}\n",
+		},
+		{
+			name:        "SecureJSON default prefix",
+			handler:     func(ctx *Context) { ctx.SecureJSON(http.StatusOK, []int{1, 2}) },
+			code:        http.StatusOK,
+			contentType: jsonContentType,
+			body:        "while(1);[1,2]",
+		},
+		{
+			name:        "AsciiJSON BMP",
+			handler:     func(ctx *Context) { ctx.AsciiJSON(http.StatusOK, map[string]string{"lang": "中文"}) },
+			code:        http.StatusOK,
+			contentType: jsonContentType,
+			body:        `{"lang":"\u4e2d\u6587"}`,
+		},
+		{
+			name:        "AsciiJSON surrogate pair",
+			handler:     func(ctx *Context) { ctx.AsciiJSON(http.StatusOK, "a😀b") },
+			code:        http.StatusOK,
+			contentType: jsonContentType,
+			body:        `"a\ud83d\ude00b"`,
+		},
+		{
+			name:        "JSONP with callback",
+			url:         "?callback=app.cb_1",
+			handler:     func(ctx *Context) { ctx.JSONP(http.StatusOK, map[string]int{"a": 1}) },
+			code:        http.StatusOK,
+			contentType: javascriptContentType,
+			body:        `/**/ typeof app.cb_1 === 'function' && app.cb_1({"a":1});`,
+		},
+		{
+			name:        "JSONP without callback",
+			handler:     func(ctx *Context) { ctx.JSONP(http.StatusOK, map[string]int{"a": 1}) },
+			code:        http.StatusOK,
+			contentType: jsonContentType,
+			body:        `{"a":1}`,
+		},
+		{
+			name:    "JSONP rejects script injection",
+			url:     "?callback=alert(1)//",
+			handler: func(ctx *Context) { ctx.JSONP(http.StatusOK, map[string]int{"a": 1}) },
+			code:    http.StatusBadRequest,
+			body:    "invalid jsonp callback",
+		},
+		{
+			name:        "no body for 204",
+			handler:     func(ctx *Context) { ctx.Json(http.StatusNoContent, data) },
+			code:        http.StatusNoContent,
+			contentType: jsonContentType,
+			body:        "",
+		},
+		{
+			name:        "no body for 304",
+			handler:     func(ctx *Context) { ctx.Json(http.StatusNotModified, data) },
+			code:        http.StatusNotModified,
+			contentType: jsonContentType,
+			body:        "",
+		},
+		{
+			name:        "render error returns 500",
+			handler:     func(ctx *Context) { ctx.Json(http.StatusOK, make(chan int)) },
+			code:        http.StatusInternalServerError,
+			contentType: "text/plain; charset=utf-8",
+			body:        "json: unsupported type: chan int\n",
+		},
+	})
+}
+
+func TestSecureJSONCustomPrefix(t *testing.T) {
+	e := NewEngine()
+	e.SetSecureJSONPrefix(")]}',\n")
+	runRenderCases(t, e, []renderCase{{
+		name:        "custom prefix",
+		handler:     func(ctx *Context) { ctx.SecureJSON(http.StatusOK, []int{1}) },
+		code:        http.StatusOK,
+		contentType: jsonContentType,
+		body:        ")]}',\n[1]",
+	}})
+}
+
+func TestValidJSONPCallback(t *testing.T) {
+	tests := []struct {
+		callback string
+		valid    bool
+	}{
+		{"", true},
+		{"cb", true},
+		{"$.jsonp_1", true},
+		{"alert(1)", false},
+		{"cb;alert(1)", false},
+		{"cb</script>", false},
+		{"a b", false},
+		{"回调", false},
+		{string(make([]byte, 129)), false},
+	}
+	for _, tt := range tests {
+		if got := validJSONPCallback(tt.callback); got != tt.valid {
+			t.Errorf("validJSONPCallback(%q) = %v, want %v", tt.callback, got, tt.valid)
+		}
+	}
+}
+
+type failingRender struct{}
+
+func (failingRender) ContentType() string { return "application/x-test" }
+
+func (failingRender) Render(w io.Writer) error {
+	io.WriteString(w, "partial")
+	return errors.New("boom")
+}
+
+func TestRenderErrorDiscardsPartialOutput(t *testing.T) {
+	runRenderCases(t, NewEngine(), []renderCase{{
+		name:        "failing render",
+		handler:     func(ctx *Context) { ctx.Render(http.StatusOK, failingRender{}) },
+		code:        http.StatusInternalServerError,
+		contentType: "text/plain; charset=utf-8",
+		body:        "boom\n",
+	}})
+}
@@ -0,0 +1,142 @@
+package ex
+
+/*
+ * 请求id的生成和转发
+ */
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// 保存在context.Context中的请求id和RequestID中间件使用的请求头
+type requestIDValue struct {
+	id     string
+	header string
+}
+
+func withRequestID(ctx context.Context, id, header string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestIDValue{id: id, header: header})
+}
+
+// 从context.Context中获取请求id
+func RequestIDFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(requestIDKey{}).(requestIDValue)
+	return v.id
+}
+
+// 当前请求的id，没有使用RequestID中间件时为空
+func (ctx *Context) RequestID() string {
+	return ctx.requestID
+}
+
+// 随机生成的UUID(版本4)
+func UUIDv4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+// 按时间排序的UUID(版本7)，前48位为毫秒时间戳
+func UUIDv7() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	rand.Read(b[6:])
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+func formatUUID(b [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// 按时间排序的ULID，26个Crockford base32字符
+func ULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	rand.Read(b[6:])
+
+	// 128位按5位一组编码，最高的两位补0
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// 把请求id转发给下游服务的http.RoundTripper，id从请求的context.Context中获取
+type RequestIDTransport struct {
+	// 为空时使用http.DefaultTransport
+	Base http.RoundTripper
+	// 为空时使用RequestID中间件配置的请求头，context中没有时使用X-Request-ID
+	Header string
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	v, _ := req.Context().Value(requestIDKey{}).(requestIDValue)
+	header := t.Header
+	if header == "" {
+		header = v.header
+	}
+	if header == "" {
+		header = RequestIDHeader
+	}
+	if v.id != "" && req.Header.Get(header) == "" {
+		// RoundTripper不能修改传入的请求
+		req = req.Clone(req.Context())
+		req.Header.Set(header, v.id)
+	}
+	return base.RoundTrip(req)
+}
+
+// 创建一个发往下游服务的请求，使用当前请求的context.Context并带上请求id
+// 请求id使用RequestID中间件配置的请求头
+func (ctx *Context) NewRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx.Req.Context(), method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.requestID != "" {
+		header := ctx.requestIDHeader
+		if header == "" {
+			header = RequestIDHeader
+		}
+		req.Header.Set(header, ctx.requestID)
+	}
+	return req, nil
+}
@@ -0,0 +1,155 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDForwardedUnderConfiguredHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RequestIDConfig
+		header string
+	}{
+		{"default", RequestIDConfig{}, RequestIDHeader},
+		{"custom", RequestIDConfig{Header: "X-Trace-ID"}, "X-Trace-ID"},
+	}
+	for _, tt := range tests {
+		e := NewEngine()
+		e.Use(RequestIDWithConfig(tt.config))
+		var forwarded *http.Request
+		e.GET("/orders", func(ctx *Context) {
+			req, err := ctx.NewRequest(http.MethodGet, "http://inventory/items", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			forwarded = req
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set(tt.header, "abc-123")
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+
+		if got := w.Header().Get(tt.header); got != "abc-123" {
+			t.Errorf("%s: response %s = %q, want abc-123", tt.name, tt.header, got)
+		}
+		if got := forwarded.Header.Get(tt.header); got != "abc-123" {
+			t.Errorf("%s: forwarded %s = %q, want abc-123", tt.name, tt.header, got)
+		}
+		if tt.header != RequestIDHeader && forwarded.Header.Get(RequestIDHeader) != "" {
+			t.Errorf("%s: id also forwarded under %s", tt.name, RequestIDHeader)
+		}
+		if got := RequestIDFromContext(forwarded.Context()); got != "abc-123" {
+			t.Errorf("%s: RequestIDFromContext = %q, want abc-123", tt.name, got)
+		}
+	}
+}
+
+func TestRequestIDRejectsInvalidID(t *testing.T) {
+	e := NewEngine()
+	e.Use(RequestID())
+	var id string
+	e.GET("/", func(ctx *Context) { id = ctx.RequestID() })
+
+	for _, bad := range []string{"a b", "x\ny", strings.Repeat("a", 65)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, bad)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		if id == bad || id == "" {
+			t.Errorf("client id %q was not replaced, got %q", bad, id)
+		}
+	}
+}
+
+func TestRequestIDGenerators(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([47])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if m := uuid.FindStringSubmatch(UUIDv4()); m == nil || m[1] != "4" {
+		t.Errorf("UUIDv4 has the wrong format")
+	}
+	if m := uuid.FindStringSubmatch(UUIDv7()); m == nil || m[1] != "7" {
+		t.Errorf("UUIDv7 has the wrong format")
+	}
+	if a, b := UUIDv7(), UUIDv7(); a[:13] > b[:13] {
+		t.Errorf("UUIDv7 not ordered by time: %s > %s", a, b)
+	}
+	if id := ULID(); !regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`).MatchString(id) {
+		t.Errorf("ULID %q has the wrong format", id)
+	}
+}
+
+// 记录发出的请求，不访问网络
+type recordingTransport struct {
+	req *http.Request
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.req = req
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestRequestIDTransportHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware string
+		transport  string
+		preset     string
+		want       string
+	}{
+		{"default", "", "", "", RequestIDHeader},
+		{"middleware header", "X-Trace-ID", "", "", "X-Trace-ID"},
+		{"transport header wins", "X-Trace-ID", "X-Correlation-ID", "", "X-Correlation-ID"},
+		{"existing header kept", "X-Trace-ID", "", "X-Trace-ID", "X-Trace-ID"},
+	}
+	for _, tt := range tests {
+		rec := &recordingTransport{}
+		client := &http.Client{Transport: &RequestIDTransport{Base: rec, Header: tt.transport}}
+
+		e := NewEngine()
+		e.Use(RequestIDWithConfig(RequestIDConfig{Header: tt.middleware}))
+		e.GET("/orders", func(ctx *Context) {
+			// 不使用ctx.NewRequest，只依赖context中的请求id
+			req, _ := http.NewRequestWithContext(ctx.Req.Context(), http.MethodGet, "http://inventory/items", nil)
+			if tt.preset != "" {
+				req.Header.Set(tt.preset, "preset")
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		})
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set(tt.want, "abc-123")
+		if tt.middleware != "" {
+			req.Header.Set(tt.middleware, "abc-123")
+		}
+		e.ServeHTTP(httptest.NewRecorder(), req)
+
+		want := "abc-123"
+		if tt.preset != "" {
+			want = "preset"
+		}
+		if got := rec.req.Header.Get(tt.want); got != want {
+			t.Errorf("%s: forwarded %s = %q, want %q", tt.name, tt.want, got, want)
+		}
+		for _, other := range []string{RequestIDHeader, "X-Trace-ID", "X-Correlation-ID"} {
+			if other != tt.want && rec.req.Header.Get(other) != "" {
+				t.Errorf("%s: id also forwarded under %s", tt.name, other)
+			}
+		}
+	}
+
+	// 没有请求id时不添加请求头
+	rec := &recordingTransport{}
+	req := httptest.NewRequest(http.MethodGet, "http://inventory/items", nil)
+	if _, err := (&RequestIDTransport{Base: rec}).RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.req.Header.Get(RequestIDHeader); got != "" {
+		t.Errorf("header %q set without a request id", got)
+	}
+}
@@ -0,0 +1,88 @@
+package ex
+
+/*
+ * 包装http.ResponseWriter，记录状态码和写入的字节数
+ */
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+type responseWriter struct {
+	http.ResponseWriter
+	ctx     *Context
+	status  int
+	size    int64
+	written bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// 1xx是中间响应，后面还会有最终的状态码
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.written {
+		return
+	}
+	w.written = true
+	w.status = code
+	w.ctx.StatusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// websocket需要接管连接
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && !w.written {
+		w.written = true
+		w.status = http.StatusSwitchingProtocols
+		w.ctx.StatusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// 供http.ResponseController使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// 响应头是否已经发送
+func (ctx *Context) Written() bool {
+	if w, ok := ctx.Writer.(*responseWriter); ok {
+		return w.written
+	}
+	return ctx.StatusCode != 0
+}
+
+// 已经写入的响应体字节数
+func (ctx *Context) ResponseSize() int64 {
+	if w, ok := ctx.Writer.(*responseWriter); ok {
+		return w.size
+	}
+	return 0
+}
@@ -0,0 +1,253 @@
+package ex
+
+/*
+ * 按大小和时间切割的日志文件
+ * 切割后的文件名为"原文件名.时间戳"，可以选择gzip压缩，超出数量的旧文件会被删除
+ */
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotateTimeFormat = "2006-01-02T15-04-05.000"
+
+// 日志切割配置
+type RotatingFileConfig struct {
+	// 日志文件路径
+	Filename string
+	// 文件超过这个字节数时切割，0表示不按大小切割
+	MaxSize int64
+	// 文件打开超过这个时间时切割，0表示不按时间切割
+	Interval time.Duration
+	// 保留的旧文件数量，0表示全部保留
+	MaxBackups int
+	// 是否gzip压缩切割后的文件
+	Compress bool
+	// 后台压缩失败时调用，默认通过slog记录，压缩失败的文件保留原样并参与MaxBackups计数
+	ErrorHandler func(err error)
+}
+
+// 自动切割的日志文件，可以并发写入
+type RotatingFile struct {
+	config RotatingFileConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+	// 正在后台压缩的文件，清理旧文件时跳过
+	compressing map[string]bool
+	compress    func(name string) error
+	wg          sync.WaitGroup
+}
+
+// 打开日志文件，文件已经存在时追加写入
+func NewRotatingFile(config RotatingFileConfig) (*RotatingFile, error) {
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(err error) {
+			slog.Warn("rotating file: compress failed", "error", err)
+		}
+	}
+	r := &RotatingFile{
+		config:      config,
+		compressing: make(map[string]bool),
+		compress:    compressFile,
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Filename), 0o755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.config.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	// 之前切割失败且没能重新打开时再试一次
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) shouldRotate(next int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.config.MaxSize > 0 && r.size+next > r.config.MaxSize {
+		return true
+	}
+	return r.config.Interval > 0 && time.Since(r.openedAt) >= r.config.Interval
+}
+
+// 立即切割日志文件
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file == nil {
+		return r.open()
+	}
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return r.reopen(err)
+	}
+	backup := r.config.Filename + "." + time.Now().Format(rotateTimeFormat)
+	// 同一毫秒内多次切割时加上序号避免覆盖
+	for i := 1; fileExists(backup) || fileExists(backup+".gz"); i++ {
+		backup = r.config.Filename + "." + time.Now().Format(rotateTimeFormat) + "-" + strconv.Itoa(i)
+	}
+	if err := os.Rename(r.config.Filename, backup); err != nil {
+		return r.reopen(err)
+	}
+	if err := r.open(); err != nil {
+		return r.reopen(err)
+	}
+
+	// 压缩和清理放到后台，不阻塞写日志
+	if r.config.Compress {
+		r.compressing[backup] = true
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if r.config.Compress {
+			if err := r.compress(backup); err != nil {
+				r.config.ErrorHandler(err)
+			}
+			r.mu.Lock()
+			delete(r.compressing, backup)
+			r.mu.Unlock()
+		}
+		r.removeOldBackups()
+	}()
+	return nil
+}
+
+// 切割失败时重新以追加方式打开原文件，保证之后的日志还能写入，返回切割的错误
+func (r *RotatingFile) reopen(err error) error {
+	if r.file == nil {
+		r.open()
+	}
+	return err
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+func (r *RotatingFile) removeOldBackups() {
+	if r.config.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(r.config.Filename + ".*")
+	if err != nil {
+		return
+	}
+	// 时间戳格式保证按文件名排序就是按时间排序
+	sort.Strings(matches)
+	r.mu.Lock()
+	backups := matches[:0]
+	for _, m := range matches {
+		// 跳过正在压缩的文件和压缩了一半的.gz，压缩失败的文件按普通备份处理
+		if r.compressing[strings.TrimSuffix(m, ".gz")] {
+			continue
+		}
+		backups = append(backups, m)
+	}
+	r.mu.Unlock()
+	for len(backups) > r.config.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// 关闭日志文件并等待后台的压缩完成
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	r.closed = true
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
@@ -0,0 +1,175 @@
+package ex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRotatingFileRotate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(RotatingFileConfig{Filename: name, MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "bbbbbbbb\n" {
+		t.Errorf("current file = %q, want only the second line", data)
+	}
+	backups, _ := filepath.Glob(name + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+}
+
+func TestRotatingFileRecoversFromFailedRotate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(RotatingFileConfig{Filename: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	// 文件被外部删除后重命名会失败
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Rotate(); err == nil {
+		t.Fatal("Rotate succeeded without a file to rename")
+	}
+
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatalf("Write after failed rotate: %v", err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "after") {
+		t.Errorf("log file = %q, want the line written after the failed rotate", data)
+	}
+}
+
+func TestRotatingFileClosed(t *testing.T) {
+	f, err := NewRotatingFile(RotatingFileConfig{Filename: filepath.Join(t.TempDir(), "access.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x\n")); err != os.ErrClosed {
+		t.Errorf("Write after Close = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestRotatingFileRecoversFromFailedClose(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(RotatingFileConfig{Filename: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	// 提前关闭底层文件，切割时Close会返回错误
+	f.file.Close()
+	if err := f.Rotate(); err == nil {
+		t.Fatal("Rotate succeeded although Close failed")
+	}
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatalf("Write after failed close: %v", err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "before\nafter\n" {
+		t.Errorf("log file = %q", data)
+	}
+}
+
+func rotateN(t *testing.T, f *RotatingFile, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := f.Write([]byte("line\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRotatingFileCompressAndPrune(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(RotatingFileConfig{Filename: name, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotateN(t, f, 4)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := filepath.Glob(name + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("backups %v, want 2", backups)
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".gz") {
+			t.Errorf("backup %s not compressed", b)
+		}
+	}
+}
+
+func TestRotatingFileCompressFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	var mu sync.Mutex
+	var errs []error
+	f, err := NewRotatingFile(RotatingFileConfig{
+		Filename:   name,
+		MaxBackups: 2,
+		Compress:   true,
+		ErrorHandler: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.compress = func(string) error { return errors.New("disk full") }
+	rotateN(t, f, 4)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 4 || errs[0].Error() != "disk full" {
+		t.Errorf("ErrorHandler got %v, want 4 compress errors", errs)
+	}
+	// 压缩失败的文件也要按MaxBackups清理
+	backups, _ := filepath.Glob(name + ".*")
+	if len(backups) != 2 {
+		t.Errorf("backups %v, want 2 uncompressed", backups)
+	}
+}
@@ -1,7 +1,9 @@
 package ex
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	ps "path"
 	"strings"
 )
@@ -13,33 +15,35 @@ import (
 // 路由结构体
 type Router struct {
 	handlers map[string]map[string]HandlerFunc
+	names    map[string]string
 }
 
 // 实例化路由结构体
 func newRouter() *Router {
 	return &Router{
 		handlers: make(map[string]map[string]HandlerFunc),
+		names:    make(map[string]string),
 	}
 }
 
-// 用户处理用户请求
-func (rt *Router) handle(ctx *Context) {
+// 用户处理用户请求，没有匹配的路由时返回false
+func (rt *Router) handle(ctx *Context) bool {
 	// 精确匹配路由
 	if methodMap, ok := rt.handlers[ctx.Req.Method]; ok {
 		if handler, ok := methodMap[ctx.Req.URL.Path]; ok {
 			handler(ctx)
-			return
+			return true
 		}
 
 		// 用于匹配静态资源路由
 		for route, handler := range methodMap {
 			if strings.HasSuffix(route, "/*filepath") {
 				handler(ctx)
-				return
+				return true
 			}
 		}
 	}
-	ctx.String(404, "404 NOT FOUND")
+	return false
 }
 
 // 用于注册用户路由操作
@@ -54,6 +58,43 @@ func (rt *Router) addRoute(method, path string, handlers []HandlerFunc) {
 	}
 }
 
+// 根据路由名生成地址，路径最后的*name用params中的值替换，其余的参数作为查询参数
+func (rt *Router) url(name string, params map[string]string) (string, error) {
+	pattern, ok := rt.names[name]
+	if !ok {
+		return "", fmt.Errorf("route %q not found", name)
+	}
+
+	used := make(map[string]bool)
+	segments := strings.Split(pattern, "/")
+	if last := segments[len(segments)-1]; len(last) > 1 && last[0] == '*' {
+		key := last[1:]
+		value, ok := params[key]
+		if !ok {
+			return "", fmt.Errorf("route %q missing param %q", name, key)
+		}
+		used[key] = true
+		// 通配的部分可以包含多级路径，每一级分别转义
+		parts := strings.Split(strings.TrimPrefix(value, "/"), "/")
+		for i, part := range parts {
+			parts[i] = url.PathEscape(part)
+		}
+		segments[len(segments)-1] = strings.Join(parts, "/")
+	}
+
+	query := url.Values{}
+	for k, v := range params {
+		if !used[k] {
+			query.Set(k, v)
+		}
+	}
+	result := strings.Join(segments, "/")
+	if len(query) > 0 {
+		result += "?" + query.Encode()
+	}
+	return result, nil
+}
+
 func (rg *RouterGroup) createStaticHandler(path string, fs http.FileSystem) HandlerFunc {
 	fsv := http.StripPrefix(rg.prefix, http.FileServer(fs))
 	return func(ctx *Context) {
@@ -0,0 +1,425 @@
+package ex
+
+/*
+ * 服务端会话
+ * 会话数据保存在SessionStore中，cookie中只保存会话id(CookieSessionStore除外)
+ * 修改会话后需要在写响应之前调用Save，登录等权限变化时调用Regenerate更换会话id
+ */
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 会话存储接口
+type SessionStore interface {
+	// 根据cookie的值读取会话，会话不存在或者已过期时返回空id
+	Load(ctx *Context, name, value string) (id string, values map[string]any, err error)
+	// 保存会话，返回需要写入cookie的值
+	Save(ctx *Context, name, id string, values map[string]any, ttl time.Duration) (value string, err error)
+	// 删除会话
+	Delete(ctx *Context, name, id string) error
+}
+
+// 会话中间件配置
+type SessionConfig struct {
+	// cookie名
+	Name  string
+	Store SessionStore
+	// 会话有效期，默认24小时
+	TTL time.Duration
+	// cookie选项，MaxAge会根据TTL设置
+	Cookie CookieOptions
+}
+
+const flashesKey = "_flashes"
+
+// 一次请求中的会话
+type SessionData struct {
+	ctx    *Context
+	config SessionConfig
+	id     string
+	values map[string]any
+}
+
+// 使用默认配置的会话中间件，cookie为HttpOnly和SameSite=Lax
+func Sessions(name string, store SessionStore) HandlerFunc {
+	return SessionsWithConfig(SessionConfig{
+		Name:  name,
+		Store: store,
+		Cookie: CookieOptions{
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	})
+}
+
+// 会话中间件
+func SessionsWithConfig(config SessionConfig) HandlerFunc {
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+	return func(ctx *Context) {
+		s := &SessionData{ctx: ctx, config: config}
+		if value, err := ctx.Cookie(config.Name); err == nil {
+			id, values, err := config.Store.Load(ctx, config.Name, value)
+			if err == nil && id != "" {
+				s.id, s.values = id, values
+			}
+		}
+		if s.values == nil {
+			s.values = make(map[string]any)
+		}
+
+		reqCtx := setValue(ctx.Req.Context(), sessionContextKey(config.Name), s)
+		// 第一个会话中间件的会话作为默认会话
+		if Session(ctx) == nil {
+			reqCtx = setValue(reqCtx, sessionContextKey(""), s)
+		}
+		ctx.Req = ctx.Req.WithContext(reqCtx)
+		ctx.Next()
+	}
+}
+
+func sessionContextKey(name string) string {
+	return "session:" + name
+}
+
+// 获取当前请求的会话，不传name时返回第一个会话中间件的会话
+func Session(ctx *Context, name ...string) *SessionData {
+	key := ""
+	if len(name) > 0 {
+		key = name[0]
+	}
+	if s, ok := ctx.Req.Context().Value(contextKey(sessionContextKey(key))).(*SessionData); ok {
+		return s
+	}
+	return nil
+}
+
+// 会话id，新会话在第一次保存前为空
+func (s *SessionData) ID() string {
+	return s.id
+}
+
+func (s *SessionData) Get(key string) any {
+	return s.values[key]
+}
+
+func (s *SessionData) Set(key string, value any) {
+	s.values[key] = value
+}
+
+func (s *SessionData) Delete(key string) {
+	delete(s.values, key)
+}
+
+// 清空会话数据
+func (s *SessionData) Clear() {
+	s.values = make(map[string]any)
+}
+
+// 添加一条闪存消息，消息被Flashes读取一次后删除
+func (s *SessionData) Flash(value any) {
+	flashes, _ := s.values[flashesKey].([]any)
+	s.values[flashesKey] = append(flashes, value)
+}
+
+// 读取并删除所有闪存消息，需要Save后删除才会生效
+func (s *SessionData) Flashes() []any {
+	flashes, _ := s.values[flashesKey].([]any)
+	delete(s.values, flashesKey)
+	return flashes
+}
+
+// 保存会话并设置cookie，需要在写响应之前调用
+func (s *SessionData) Save() error {
+	if s.id == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+		s.id = id
+	}
+	value, err := s.config.Store.Save(s.ctx, s.config.Name, s.id, s.values, s.config.TTL)
+	if err != nil {
+		return err
+	}
+	opts := s.config.Cookie
+	opts.MaxAge = int(s.config.TTL / time.Second)
+	s.ctx.SetCookie(s.config.Name, value, opts)
+	return nil
+}
+
+// 更换会话id并保存，数据保持不变，旧的会话会被删除，用于登录等权限变化时防止会话固定攻击
+func (s *SessionData) Regenerate() error {
+	if s.id != "" {
+		if err := s.config.Store.Delete(s.ctx, s.config.Name, s.id); err != nil {
+			return err
+		}
+	}
+	s.id = ""
+	return s.Save()
+}
+
+// 删除会话和cookie
+func (s *SessionData) Destroy() error {
+	if s.id != "" {
+		if err := s.config.Store.Delete(s.ctx, s.config.Name, s.id); err != nil {
+			return err
+		}
+	}
+	s.id = ""
+	s.values = make(map[string]any)
+	opts := s.config.Cookie
+	opts.MaxAge = -1
+	s.ctx.SetCookie(s.config.Name, "", opts)
+	return nil
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validSessionID(id string) bool {
+	if len(id) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// 存储中保存的会话
+type sessionRecord struct {
+	ID      string
+	Values  map[string]any
+	Expires time.Time
+}
+
+func init() {
+	gob.Register([]any{})
+	gob.Register(map[string]any{})
+}
+
+func encodeSession(record sessionRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSession(b []byte) (sessionRecord, error) {
+	var record sessionRecord
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&record)
+	return record, err
+}
+
+func copyValues(values map[string]any) map[string]any {
+	c := make(map[string]any, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+// 内存会话存储，过期的会话会在保存时被定期清理
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]sessionRecord
+	lastSweep time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:  make(map[string]sessionRecord),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemorySessionStore) Load(ctx *Context, name, value string) (string, map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.sessions[value]
+	if !ok {
+		return "", nil, nil
+	}
+	if time.Now().After(record.Expires) {
+		delete(m.sessions, value)
+		return "", nil, nil
+	}
+	return record.ID, copyValues(record.Values), nil
+}
+
+func (m *MemorySessionStore) Save(ctx *Context, name, id string, values map[string]any, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sessions[id] = sessionRecord{ID: id, Values: copyValues(values), Expires: now.Add(ttl)}
+	if now.Sub(m.lastSweep) > time.Minute {
+		m.lastSweep = now
+		for k, record := range m.sessions {
+			if now.After(record.Expires) {
+				delete(m.sessions, k)
+			}
+		}
+	}
+	return id, nil
+}
+
+func (m *MemorySessionStore) Delete(ctx *Context, name, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// 文件会话存储，每个会话一个文件，数据使用gob编码
+// 自定义类型需要先通过gob.Register注册
+type FileSessionStore struct {
+	dir string
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (f *FileSessionStore) path(id string) string {
+	return filepath.Join(f.dir, "session_"+id)
+}
+
+func (f *FileSessionStore) Load(ctx *Context, name, value string) (string, map[string]any, error) {
+	// 防止通过cookie构造路径
+	if !validSessionID(value) {
+		return "", nil, nil
+	}
+	b, err := os.ReadFile(f.path(value))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	record, err := decodeSession(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if time.Now().After(record.Expires) {
+		os.Remove(f.path(value))
+		return "", nil, nil
+	}
+	return record.ID, record.Values, nil
+}
+
+func (f *FileSessionStore) Save(ctx *Context, name, id string, values map[string]any, ttl time.Duration) (string, error) {
+	b, err := encodeSession(sessionRecord{ID: id, Values: values, Expires: time.Now().Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+	// 先写临时文件再重命名，避免并发读到写了一半的文件
+	tmp, err := os.CreateTemp(f.dir, "tmp_")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), f.path(id)); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return id, nil
+}
+
+func (f *FileSessionStore) Delete(ctx *Context, name, id string) error {
+	if !validSessionID(id) {
+		return nil
+	}
+	err := os.Remove(f.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// 删除所有过期的会话文件，可以定期调用
+func (f *FileSessionStore) Cleanup() error {
+	files, err := filepath.Glob(filepath.Join(f.dir, "session_*"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if record, err := decodeSession(b); err != nil || now.After(record.Expires) {
+			os.Remove(file)
+		}
+	}
+	return nil
+}
+
+// cookie会话存储，会话数据使用引擎的cookie密钥签名后保存在cookie中
+// cookie大小有限制，只适合保存少量数据
+type CookieSessionStore struct{}
+
+func NewCookieSessionStore() *CookieSessionStore {
+	return &CookieSessionStore{}
+}
+
+func (CookieSessionStore) Load(ctx *Context, name, value string) (string, map[string]any, error) {
+	keys := ctx.cookieKeys()
+	if len(keys) == 0 {
+		return "", nil, ErrCookieKeyMissing
+	}
+	b, err := verifySignedCookie(keys, name, value)
+	if err != nil {
+		return "", nil, nil
+	}
+	record, err := decodeSession([]byte(b))
+	if err != nil || time.Now().After(record.Expires) {
+		return "", nil, nil
+	}
+	return record.ID, record.Values, nil
+}
+
+func (CookieSessionStore) Save(ctx *Context, name, id string, values map[string]any, ttl time.Duration) (string, error) {
+	keys := ctx.cookieKeys()
+	if len(keys) == 0 {
+		return "", ErrCookieKeyMissing
+	}
+	b, err := encodeSession(sessionRecord{ID: id, Values: values, Expires: time.Now().Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(b)
+	return encoded + "." + signCookie(keys[0], name, encoded), nil
+}
+
+// cookie中的会话无法在服务端删除，cookie会被中间件清除或者覆盖
+func (CookieSessionStore) Delete(ctx *Context, name, id string) error {
+	return nil
+}
@@ -0,0 +1,229 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 会话测试服务，请求之间手动传递cookie
+type sessionClient struct {
+	t      *testing.T
+	e      *Engine
+	cookie *http.Cookie
+}
+
+func newSessionClient(t *testing.T, store SessionStore) *sessionClient {
+	e := NewEngine()
+	e.SetCookieKeys([]byte("session-test-key"))
+	e.Use(Sessions("sid", store))
+	e.GET("/set", func(ctx *Context) {
+		s := Session(ctx)
+		s.Set(ctx.Query("k"), ctx.Query("v"))
+		s.Save()
+		ctx.String(http.StatusOK, s.ID())
+	})
+	e.GET("/get", func(ctx *Context) {
+		v, _ := Session(ctx).Get(ctx.Query("k")).(string)
+		ctx.String(http.StatusOK, v)
+	})
+	e.GET("/id", func(ctx *Context) {
+		ctx.String(http.StatusOK, Session(ctx).ID())
+	})
+	e.GET("/flash", func(ctx *Context) {
+		s := Session(ctx)
+		s.Flash(ctx.Query("msg"))
+		s.Save()
+	})
+	e.GET("/flashes", func(ctx *Context) {
+		s := Session(ctx)
+		var msgs []string
+		for _, f := range s.Flashes() {
+			msgs = append(msgs, f.(string))
+		}
+		s.Save()
+		ctx.String(http.StatusOK, strings.Join(msgs, ","))
+	})
+	e.GET("/login", func(ctx *Context) {
+		s := Session(ctx)
+		if err := s.Regenerate(); err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		ctx.String(http.StatusOK, s.ID())
+	})
+	e.GET("/logout", func(ctx *Context) {
+		Session(ctx).Destroy()
+	})
+	return &sessionClient{t: t, e: e}
+}
+
+// 发送请求并记录响应中的会话cookie
+func (c *sessionClient) get(url string) string {
+	c.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+	w := httptest.NewRecorder()
+	c.e.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "sid" {
+			c.cookie = cookie
+			if cookie.MaxAge < 0 {
+				c.cookie = nil
+			}
+		}
+	}
+	return w.Body.String()
+}
+
+func sessionStores(t *testing.T) map[string]SessionStore {
+	fileStore, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"file":   fileStore,
+		"cookie": NewCookieSessionStore(),
+	}
+}
+
+func TestSessionPersistsAcrossRequests(t *testing.T) {
+	for name, store := range sessionStores(t) {
+		c := newSessionClient(t, store)
+		if got := c.get("/get?k=user"); got != "" {
+			t.Errorf("%s: new session has value %q", name, got)
+		}
+		id := c.get("/set?k=user&v=alice")
+		if !validSessionID(id) {
+			t.Errorf("%s: session id %q", name, id)
+		}
+		if c.cookie == nil || !c.cookie.HttpOnly || c.cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("%s: cookie %+v", name, c.cookie)
+		}
+		if name != "cookie" && c.cookie.Value != id {
+			t.Errorf("%s: cookie should only contain the session id", name)
+		}
+		if got := c.get("/get?k=user"); got != "alice" {
+			t.Errorf("%s: got %q, want alice", name, got)
+		}
+		if got := c.get("/id"); got != id {
+			t.Errorf("%s: id changed to %q", name, got)
+		}
+
+		c.get("/logout")
+		if got := c.get("/get?k=user"); got != "" {
+			t.Errorf("%s: value %q survived Destroy", name, got)
+		}
+	}
+}
+
+func TestSessionFlashReadOnce(t *testing.T) {
+	for name, store := range sessionStores(t) {
+		c := newSessionClient(t, store)
+		c.get("/flash?msg=saved")
+		c.get("/flash?msg=again")
+		if got := c.get("/flashes"); got != "saved,again" {
+			t.Errorf("%s: flashes %q", name, got)
+		}
+		if got := c.get("/flashes"); got != "" {
+			t.Errorf("%s: flashes read twice: %q", name, got)
+		}
+	}
+}
+
+func TestSessionRegenerate(t *testing.T) {
+	for name, store := range sessionStores(t) {
+		c := newSessionClient(t, store)
+		oldID := c.get("/set?k=user&v=alice")
+		oldCookie := c.cookie
+
+		newID := c.get("/login")
+		if newID == oldID || !validSessionID(newID) {
+			t.Errorf("%s: id %q after Regenerate, old %q", name, newID, oldID)
+		}
+		if got := c.get("/get?k=user"); got != "alice" {
+			t.Errorf("%s: data lost after Regenerate: %q", name, got)
+		}
+
+		// cookie存储无法在服务端删除旧会话
+		if name == "cookie" {
+			continue
+		}
+		c.cookie = oldCookie
+		if got := c.get("/id"); got != "" {
+			t.Errorf("%s: old session %q still loadable", name, got)
+		}
+	}
+}
+
+func TestSessionStoreTTL(t *testing.T) {
+	for name, store := range sessionStores(t) {
+		ctx := newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		ctx.engine = NewEngine()
+		ctx.engine.SetCookieKeys([]byte("session-test-key"))
+
+		id, _ := newSessionID()
+		value, err := store.Save(ctx, "sid", id, map[string]any{"k": "v"}, 20*time.Millisecond)
+		if err != nil {
+			t.Fatalf("%s: save: %v", name, err)
+		}
+		if got, values, err := store.Load(ctx, "sid", value); err != nil || got != id || values["k"] != "v" {
+			t.Errorf("%s: load before expiry: %q %v %v", name, got, values, err)
+		}
+		time.Sleep(40 * time.Millisecond)
+		if got, _, err := store.Load(ctx, "sid", value); err != nil || got != "" {
+			t.Errorf("%s: load after expiry: %q %v", name, got, err)
+		}
+	}
+}
+
+func TestFileSessionStoreRejectsInvalidIDs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 在目录外和目录内放一个格式正确的会话文件，非法id都不能读到
+	b, err := encodeSession(sessionRecord{ID: "x", Values: map[string]any{}, Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonHex := strings.Repeat("z", 64)
+	for _, p := range []string{
+		filepath.Join(dir, "session_"+nonHex),
+		filepath.Join(filepath.Dir(dir), "session_outside"),
+	} {
+		if err := os.WriteFile(p, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(p)
+	}
+
+	for _, value := range []string{
+		nonHex,
+		"../session_outside",
+		"../../etc/passwd",
+		strings.Repeat("a", 63),
+		strings.Repeat("a", 65),
+		"",
+	} {
+		id, values, err := store.Load(nil, "sid", value)
+		if id != "" || values != nil || err != nil {
+			t.Errorf("Load(%q) = %q, %v, %v", value, id, values, err)
+		}
+	}
+	if err := store.Delete(nil, "sid", nonHex); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "session_"+nonHex)); err != nil {
+		t.Errorf("Delete with invalid id removed a file: %v", err)
+	}
+}
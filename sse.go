@@ -0,0 +1,279 @@
+package ex
+
+/*
+ * Server-Sent Events
+ * 支持事件id，retry，注释心跳，客户端断开自动停止，以及按Last-Event-ID重发事件
+ */
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 向已经关闭的SSEStream发送事件时返回
+var ErrSSEClosed = errors.New("sse stream closed")
+
+// 一个SSE事件
+type SSEEvent struct {
+	// 事件id，客户端重连时会通过Last-Event-ID带回
+	ID string
+	// 事件名，为空时客户端按message处理
+	Event string
+	// 事件数据，string和[]byte原样发送，其他类型编码为json
+	Data any
+	// 建议客户端的重连间隔，0表示不发送
+	Retry time.Duration
+}
+
+// SSE配置
+type SSEConfig struct {
+	// 连接建立时发送给客户端的重连间隔
+	Retry time.Duration
+	// 心跳间隔，大于0时定期发送注释行防止连接被代理断开
+	Heartbeat time.Duration
+	// 重发缓冲区，客户端带着Last-Event-ID重连时会重发之后的事件
+	// 事件需要在发布时通过SSEReplay.Add记录一次，Send不会记录
+	Replay *SSEReplay
+}
+
+// SSE事件流
+type SSEStream struct {
+	ctx    *Context
+	codec  JSONCodec
+	replay *SSEReplay
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// 使用默认配置开始一个SSE事件流
+func (ctx *Context) SSE() *SSEStream {
+	return ctx.SSEWithConfig(SSEConfig{})
+}
+
+// 开始一个SSE事件流，响应头只会在这里发送一次
+// 处理函数返回前需要调用Close，客户端断开时事件流会自动关闭
+func (ctx *Context) SSEWithConfig(config SSEConfig) *SSEStream {
+	s := &SSEStream{
+		ctx:    ctx,
+		codec:  ctx.JSONCodec(),
+		replay: config.Replay,
+		done:   make(chan struct{}),
+	}
+
+	setSSEHeaders(ctx.Writer.Header())
+	ctx.Status(http.StatusOK)
+
+	if config.Retry > 0 {
+		fmt.Fprintf(ctx.Writer, "retry: %d\n\n", config.Retry.Milliseconds())
+	}
+	if s.replay != nil {
+		lastID := ctx.Req.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			// EventSource不支持自定义请求头时可以通过查询参数传递
+			lastID = ctx.Query("lastEventId")
+		}
+		if lastID != "" {
+			for _, ev := range s.replay.Since(lastID) {
+				writeSSEEvent(ctx.Writer, ev, s.codec)
+			}
+		}
+	}
+	ctx.flush()
+
+	s.wg.Add(1)
+	go s.watch(config.Heartbeat)
+	return s
+}
+
+// 监听客户端断开，并按间隔发送心跳
+func (s *SSEStream) watch(heartbeat time.Duration) {
+	defer s.wg.Done()
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ctx.Req.Context().Done():
+			s.close()
+			return
+		case <-tick:
+			if err := s.Comment("ping"); err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// 发送一个事件
+func (s *SSEStream) Send(ev SSEEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSSEClosed
+	}
+	if err := writeSSEEvent(s.ctx.Writer, ev, s.codec); err != nil {
+		s.closeLocked()
+		return err
+	}
+	s.ctx.flush()
+	return nil
+}
+
+// 发送一个只有事件名和数据的事件
+func (s *SSEStream) Event(event string, data any) error {
+	return s.Send(SSEEvent{Event: event, Data: data})
+}
+
+// 发送注释行，客户端会忽略注释，一般用于心跳
+func (s *SSEStream) Comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSSEClosed
+	}
+	for _, line := range splitSSELines(text) {
+		if _, err := fmt.Fprintf(s.ctx.Writer, ": %s\n", line); err != nil {
+			s.closeLocked()
+			return err
+		}
+	}
+	if _, err := io.WriteString(s.ctx.Writer, "\n"); err != nil {
+		s.closeLocked()
+		return err
+	}
+	s.ctx.flush()
+	return nil
+}
+
+// 事件流关闭时会被关闭，可以用于select
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// 关闭事件流并等待心跳停止，之后不会再写入响应
+func (s *SSEStream) Close() {
+	s.close()
+	s.wg.Wait()
+}
+
+func (s *SSEStream) close() {
+	s.mu.Lock()
+	s.closeLocked()
+	s.mu.Unlock()
+}
+
+func (s *SSEStream) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+func setSSEHeaders(header http.Header) {
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 关闭nginx的响应缓冲
+	header.Set("X-Accel-Buffering", "no")
+}
+
+// 按照SSE格式写入事件，多行数据会拆分成多个data字段
+func writeSSEEvent(w io.Writer, ev SSEEvent, codec JSONCodec) error {
+	var payload string
+	switch v := ev.Data.(type) {
+	case string:
+		payload = v
+	case []byte:
+		payload = string(v)
+	case nil:
+	default:
+		b, err := codec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		payload = string(b)
+	}
+
+	var b strings.Builder
+	if ev.ID != "" {
+		// id中不能有换行和NUL
+		fmt.Fprintf(&b, "id: %s\n", strings.NewReplacer("\r", "", "\n", "", "\x00", "").Replace(ev.ID))
+	}
+	if ev.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", strings.NewReplacer("\r", "", "\n", "").Replace(ev.Event))
+	}
+	if ev.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", ev.Retry.Milliseconds())
+	}
+	for _, line := range splitSSELines(payload) {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// 按\r\n，\r和\n拆分行
+func splitSSELines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
+
+// SSE重发缓冲区，保存最近的事件，可以在多个连接之间共享
+// 每个事件只在发布时Add一次，再把返回的带id的事件发送给各个连接
+type SSEReplay struct {
+	mu     sync.Mutex
+	size   int
+	events []SSEEvent
+	nextID uint64
+}
+
+// 创建一个最多保存size个事件的重发缓冲区
+func NewSSEReplay(size int) *SSEReplay {
+	if size <= 0 {
+		size = 100
+	}
+	return &SSEReplay{size: size}
+}
+
+// 记录一个事件，事件没有id时自动分配递增的id
+func (r *SSEReplay) Add(ev SSEEvent) SSEEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	if ev.ID == "" {
+		ev.ID = strconv.FormatUint(r.nextID, 10)
+	}
+	r.events = append(r.events, ev)
+	if len(r.events) > r.size {
+		r.events = append(r.events[:0:0], r.events[len(r.events)-r.size:]...)
+	}
+	return ev
+}
+
+// 返回lastID之后的事件，lastID已经不在缓冲区中时返回全部事件
+func (r *SSEReplay) Since(lastID string) []SSEEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].ID == lastID {
+			return append([]SSEEvent(nil), r.events[i+1:]...)
+		}
+	}
+	return append([]SSEEvent(nil), r.events...)
+}
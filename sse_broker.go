@@ -0,0 +1,197 @@
+package ex
+
+/*
+ * SSE事件分发，按topic把事件发送给所有订阅者
+ * 每个订阅者有独立的有界缓冲区，缓冲区满时按配置丢弃事件或者断开连接
+ */
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 订阅者因为处理太慢被断开时Subscribe返回
+var ErrSSESlowConsumer = errors.New("sse subscriber too slow")
+
+// 订阅者缓冲区满时的处理策略
+type SSESlowPolicy int
+
+const (
+	// 丢弃新的事件，保持连接
+	SSEDropEvents SSESlowPolicy = iota
+	// 断开订阅者的连接，客户端可以重连
+	SSEDisconnect
+)
+
+// SSEBroker配置
+type SSEBrokerConfig struct {
+	// 每个订阅者的缓冲区大小，默认16
+	BufferSize int
+	// 缓冲区满时的处理策略
+	SlowPolicy SSESlowPolicy
+	// 订阅者连接的心跳间隔
+	Heartbeat time.Duration
+	// 发送给客户端的重连间隔
+	Retry time.Duration
+}
+
+// SSEBroker的统计信息
+type SSEBrokerStats struct {
+	// 当前订阅者数量
+	Subscribers int
+	// 每个topic的订阅者数量
+	Topics map[string]int
+	// 发布的事件数
+	Published uint64
+	// 因为缓冲区满而丢弃的事件数
+	Dropped uint64
+	// 因为处理太慢被断开的订阅者数
+	Disconnected uint64
+}
+
+type sseSubscriber struct {
+	events chan SSEEvent
+	kicked chan struct{}
+	once   sync.Once
+}
+
+// 断开订阅者，返回这次调用是否真正断开了连接
+func (sub *sseSubscriber) kick() bool {
+	kicked := false
+	sub.once.Do(func() {
+		close(sub.kicked)
+		kicked = true
+	})
+	return kicked
+}
+
+// SSE事件分发器
+type SSEBroker struct {
+	config SSEBrokerConfig
+
+	mu          sync.RWMutex
+	topics      map[string]map[*sseSubscriber]struct{}
+	subscribers map[*sseSubscriber]struct{}
+
+	published    atomic.Uint64
+	dropped      atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+// 创建一个SSE事件分发器
+func NewSSEBroker(config SSEBrokerConfig) *SSEBroker {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 16
+	}
+	return &SSEBroker{
+		config:      config,
+		topics:      make(map[string]map[*sseSubscriber]struct{}),
+		subscribers: make(map[*sseSubscriber]struct{}),
+	}
+}
+
+// 向topic的所有订阅者发布事件，返回成功放入缓冲区的订阅者数量
+func (b *SSEBroker) Publish(topic string, ev SSEEvent) int {
+	b.published.Add(1)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	delivered := 0
+	for sub := range b.topics[topic] {
+		select {
+		case sub.events <- ev:
+			delivered++
+		default:
+			b.dropped.Add(1)
+			// 已经被断开但还没有移除的订阅者不重复计数
+			if b.config.SlowPolicy == SSEDisconnect && sub.kick() {
+				b.disconnected.Add(1)
+			}
+		}
+	}
+	return delivered
+}
+
+// 订阅topics并把事件以SSE的形式发送给客户端，会一直阻塞直到客户端断开
+// 因为处理太慢被断开时返回ErrSSESlowConsumer
+func (b *SSEBroker) Subscribe(ctx *Context, topics ...string) error {
+	sub := &sseSubscriber{
+		events: make(chan SSEEvent, b.config.BufferSize),
+		kicked: make(chan struct{}),
+	}
+	b.add(sub, topics)
+	defer b.remove(sub, topics)
+
+	stream := ctx.SSEWithConfig(SSEConfig{
+		Retry:     b.config.Retry,
+		Heartbeat: b.config.Heartbeat,
+	})
+	defer stream.Close()
+
+	for {
+		select {
+		case ev := <-sub.events:
+			if err := stream.Send(ev); err != nil {
+				if errors.Is(err, ErrSSEClosed) {
+					return nil
+				}
+				return err
+			}
+		case <-sub.kicked:
+			return ErrSSESlowConsumer
+		case <-stream.Done():
+			return nil
+		}
+	}
+}
+
+// 断开所有订阅者
+func (b *SSEBroker) Close() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subscribers {
+		sub.kick()
+	}
+}
+
+// 获取统计信息
+func (b *SSEBroker) Stats() SSEBrokerStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	stats := SSEBrokerStats{
+		Subscribers:  len(b.subscribers),
+		Topics:       make(map[string]int, len(b.topics)),
+		Published:    b.published.Load(),
+		Dropped:      b.dropped.Load(),
+		Disconnected: b.disconnected.Load(),
+	}
+	for topic, subs := range b.topics {
+		stats.Topics[topic] = len(subs)
+	}
+	return stats
+}
+
+func (b *SSEBroker) add(sub *sseSubscriber, topics []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[sub] = struct{}{}
+	for _, topic := range topics {
+		if b.topics[topic] == nil {
+			b.topics[topic] = make(map[*sseSubscriber]struct{})
+		}
+		b.topics[topic][sub] = struct{}{}
+	}
+}
+
+func (b *SSEBroker) remove(sub *sseSubscriber, topics []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, sub)
+	for _, topic := range topics {
+		delete(b.topics[topic], sub)
+		if len(b.topics[topic]) == 0 {
+			delete(b.topics, topic)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package ex
+
+import "testing"
+
+func TestSSEBrokerDisconnectCountedOnce(t *testing.T) {
+	b := NewSSEBroker(SSEBrokerConfig{BufferSize: 1, SlowPolicy: SSEDisconnect})
+	// 不消费事件的订阅者，缓冲区满后会被断开，但在移除之前仍然在topic中
+	sub := &sseSubscriber{
+		events: make(chan SSEEvent, 1),
+		kicked: make(chan struct{}),
+	}
+	b.add(sub, []string{"orders"})
+
+	for i := 0; i < 5; i++ {
+		b.Publish("orders", SSEEvent{Data: i})
+	}
+
+	stats := b.Stats()
+	if stats.Published != 5 {
+		t.Errorf("Published = %d, want 5", stats.Published)
+	}
+	if stats.Dropped != 4 {
+		t.Errorf("Dropped = %d, want 4", stats.Dropped)
+	}
+	if stats.Disconnected != 1 {
+		t.Errorf("Disconnected = %d, want 1", stats.Disconnected)
+	}
+	select {
+	case <-sub.kicked:
+	default:
+		t.Error("slow subscriber was not kicked")
+	}
+}
+
+func TestSSEBrokerDropEventsKeepsSubscriber(t *testing.T) {
+	b := NewSSEBroker(SSEBrokerConfig{BufferSize: 1})
+	sub := &sseSubscriber{
+		events: make(chan SSEEvent, 1),
+		kicked: make(chan struct{}),
+	}
+	b.add(sub, []string{"orders"})
+
+	if n := b.Publish("orders", SSEEvent{Data: 1}); n != 1 {
+		t.Errorf("first Publish delivered to %d subscribers, want 1", n)
+	}
+	if n := b.Publish("orders", SSEEvent{Data: 2}); n != 0 {
+		t.Errorf("second Publish delivered to %d subscribers, want 0", n)
+	}
+
+	stats := b.Stats()
+	if stats.Dropped != 1 || stats.Disconnected != 0 {
+		t.Errorf("Dropped = %d, Disconnected = %d, want 1 and 0", stats.Dropped, stats.Disconnected)
+	}
+	if stats.Topics["orders"] != 1 {
+		t.Errorf("orders has %d subscribers, want 1", stats.Topics["orders"])
+	}
+}
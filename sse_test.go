@@ -0,0 +1,56 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSSEReplaySharedAcrossStreams(t *testing.T) {
+	replay := NewSSEReplay(10)
+	var events []SSEEvent
+	for _, msg := range []string{"a", "b", "c"} {
+		events = append(events, replay.Add(SSEEvent{Event: "update", Data: msg}))
+	}
+
+	e := NewEngine()
+	e.GET("/events", func(ctx *Context) {
+		stream := ctx.SSEWithConfig(SSEConfig{Replay: replay})
+		defer stream.Close()
+		if ctx.Req.Header.Get("Last-Event-ID") != "" {
+			return
+		}
+		for _, ev := range events {
+			if err := stream.Send(ev); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	// 两个连接发送同样的事件，缓冲区中每个事件只记录一次
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+		if got := strings.Count(w.Body.String(), "event: update"); got != 3 {
+			t.Fatalf("stream %d got %d events, want 3", i, got)
+		}
+	}
+	if got := len(replay.Since("")); got != 3 {
+		t.Fatalf("replay holds %d events, want 3", got)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Last-Event-ID", events[0].ID)
+	e.ServeHTTP(w, req)
+	body := w.Body.String()
+	if strings.Contains(body, "id: "+events[0].ID+"\n") {
+		t.Errorf("replayed event %s the client already has:\n%s", events[0].ID, body)
+	}
+	for _, ev := range events[1:] {
+		if got := strings.Count(body, "id: "+ev.ID+"\n"); got != 1 {
+			t.Errorf("event %s replayed %d times, want 1:\n%s", ev.ID, got, body)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ex
+
+/*
+ * 流式响应，每写完一步就flush一次
+ * 客户端断开或者写入失败时停止
+ */
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	csvContentType    = "text/csv; charset=utf-8"
+)
+
+// 记录第一次写入错误，写入失败说明客户端已经断开
+type streamWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	n, err := sw.w.Write(p)
+	sw.err = err
+	return n, err
+}
+
+// 刷新缓冲区，把已经写入的数据立即发送给客户端
+func (ctx *Context) flush() {
+	if flusher, ok := ctx.Writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 循环调用step直到它返回false，每次调用后都会flush
+// 客户端断开时返回true，正常结束返回false
+func (ctx *Context) Stream(step func(w io.Writer) bool) bool {
+	done := ctx.Req.Context().Done()
+	sw := &streamWriter{w: ctx.Writer}
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+		}
+
+		keepOpen := step(sw)
+		if sw.err != nil {
+			return true
+		}
+		ctx.flush()
+		if !keepOpen {
+			return ctx.Req.Context().Err() != nil
+		}
+	}
+}
+
+// 以NDJSON的格式响应ch中的数据，每个元素一行，ch关闭后结束
+// 客户端断开时返回true
+func JSONStream[T any](ctx *Context, ch <-chan T) bool {
+	ctx.Writer.Header().Set("Content-Type", ndjsonContentType)
+	done := ctx.Req.Context().Done()
+	codec := ctx.JSONCodec()
+	return ctx.Stream(func(w io.Writer) bool {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return false
+			}
+			if err := codec.NewEncoder(w).Encode(v); err != nil {
+				return false
+			}
+			return true
+		case <-done:
+			return false
+		}
+	})
+}
+
+// 以CSV的格式分块响应rows中的数据，header不为空时先写表头，rows关闭后结束
+// 客户端断开时返回true
+func (ctx *Context) CSVStream(header []string, rows <-chan []string) bool {
+	ctx.Writer.Header().Set("Content-Type", csvContentType)
+	done := ctx.Req.Context().Done()
+	wroteHeader := len(header) == 0
+	return ctx.Stream(func(w io.Writer) bool {
+		cw := csv.NewWriter(w)
+		if !wroteHeader {
+			wroteHeader = true
+			cw.Write(header)
+			cw.Flush()
+			return cw.Error() == nil
+		}
+		select {
+		case row, ok := <-rows:
+			if !ok {
+				return false
+			}
+			cw.Write(row)
+			cw.Flush()
+			return cw.Error() == nil
+		case <-done:
+			return false
+		}
+	})
+}
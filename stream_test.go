@@ -0,0 +1,145 @@
+package ex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamStopsWhenClientGone(t *testing.T) {
+	reqCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	steps := 0
+	var clientGone bool
+	e := NewEngine()
+	e.GET("/stream", func(ctx *Context) {
+		clientGone = ctx.Stream(func(w io.Writer) bool {
+			steps++
+			io.WriteString(w, "x")
+			if steps == 3 {
+				cancel()
+			}
+			return true
+		})
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil).WithContext(reqCtx))
+
+	if !clientGone {
+		t.Error("Stream should report the client as gone")
+	}
+	if steps != 3 || w.Body.String() != "xxx" {
+		t.Errorf("steps %d, body %q; want 3 steps before stopping", steps, w.Body.String())
+	}
+	if !w.Flushed {
+		t.Error("Stream should flush after each step")
+	}
+}
+
+func TestStreamEndsNormally(t *testing.T) {
+	e := NewEngine()
+	var clientGone bool
+	e.GET("/stream", func(ctx *Context) {
+		n := 0
+		clientGone = ctx.Stream(func(w io.Writer) bool {
+			n++
+			io.WriteString(w, "x")
+			return n < 2
+		})
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if clientGone || w.Body.String() != "xx" {
+		t.Errorf("clientGone %v, body %q", clientGone, w.Body.String())
+	}
+}
+
+// 第一次写入之后就失败，模拟客户端断开
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *brokenWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("broken pipe")
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStreamStopsOnWriteError(t *testing.T) {
+	e := NewEngine()
+	steps := 0
+	var clientGone bool
+	e.GET("/stream", func(ctx *Context) {
+		clientGone = ctx.Stream(func(w io.Writer) bool {
+			steps++
+			io.WriteString(w, "x")
+			return true
+		})
+	})
+	w := &brokenWriter{ResponseRecorder: httptest.NewRecorder()}
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if !clientGone || steps != 2 {
+		t.Errorf("clientGone %v, steps %d; want true, 2", clientGone, steps)
+	}
+}
+
+func TestJSONStreamStopsWhenClientGone(t *testing.T) {
+	reqCtx, cancel := context.WithCancel(context.Background())
+	ch := make(chan int)
+	done := make(chan bool)
+
+	e := NewEngine()
+	e.GET("/ndjson", func(ctx *Context) {
+		done <- JSONStream(ctx, ch)
+	})
+	w := httptest.NewRecorder()
+	go e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ndjson", nil).WithContext(reqCtx))
+
+	ch <- 1
+	ch <- 2
+	// ch不关闭，只有请求取消才能让JSONStream返回
+	cancel()
+	select {
+	case clientGone := <-done:
+		if !clientGone {
+			t.Error("JSONStream should report the client as gone")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("JSONStream did not stop after the request was cancelled")
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ndjsonContentType {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if w.Body.String() != "1\n2\n" {
+		t.Errorf("body %q", w.Body.String())
+	}
+}
+
+func TestCSVStream(t *testing.T) {
+	rows := make(chan []string, 2)
+	rows <- []string{"1", "a,b"}
+	rows <- []string{"2", `say "hi"`}
+	close(rows)
+
+	e := NewEngine()
+	e.GET("/csv", func(ctx *Context) {
+		ctx.CSVStream([]string{"id", "name"}, rows)
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/csv", nil))
+	if ct := w.Header().Get("Content-Type"); ct != csvContentType {
+		t.Errorf("Content-Type %q", ct)
+	}
+	want := "id,name\n1,\"a,b\"\n2,\"say \"\"hi\"\"\"\n"
+	if w.Body.String() != want {
+		t.Errorf("body %q, want %q", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,122 @@
+package ex
+
+/*
+ * websocket支持
+ * 默认只允许同源请求，跨域需要在AllowOrigins中配置，防止跨站websocket劫持
+ */
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocket配置
+type WebsocketConfig struct {
+	// 允许的Origin，支持"*"和"https://*.example.com"形式的子域名通配
+	// 为空时只允许与Host相同的Origin
+	AllowOrigins []string
+	// 自定义Origin检查，设置后忽略AllowOrigins
+	CheckOrigin func(r *http.Request) bool
+	// 服务端支持的子协议，按优先级排列
+	Subprotocols []string
+	// 读写缓冲区大小，0表示使用默认值
+	ReadBufferSize  int
+	WriteBufferSize int
+	// 是否启用permessage-deflate压缩
+	EnableCompression bool
+	// 单条消息的最大字节数，0表示不限制
+	ReadLimit int64
+	// 握手超时时间
+	HandshakeTimeout time.Duration
+}
+
+// 设置引擎默认的websocket配置
+func (e *Engine) SetWebsocketConfig(config WebsocketConfig) {
+	e.wsConfig = config
+}
+
+// 使用引擎的websocket配置升级连接
+func (ctx *Context) Websocket(handler func(*websocket.Conn)) error {
+	var config WebsocketConfig
+	if ctx.engine != nil {
+		config = ctx.engine.wsConfig
+	}
+	return ctx.WebsocketWithOptions(config, handler)
+}
+
+// 使用指定的配置升级连接，handler返回后连接会被关闭
+func (ctx *Context) WebsocketWithOptions(config WebsocketConfig, handler func(*websocket.Conn)) error {
+	upgrader := websocket.Upgrader{
+		HandshakeTimeout:  config.HandshakeTimeout,
+		ReadBufferSize:    config.ReadBufferSize,
+		WriteBufferSize:   config.WriteBufferSize,
+		Subprotocols:      config.Subprotocols,
+		EnableCompression: config.EnableCompression,
+		CheckOrigin:       config.CheckOrigin,
+	}
+	if upgrader.CheckOrigin == nil {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			return checkWebsocketOrigin(r, config.AllowOrigins)
+		}
+	}
+
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Req, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if config.ReadLimit > 0 {
+		conn.SetReadLimit(config.ReadLimit)
+	}
+	if config.EnableCompression {
+		conn.EnableWriteCompression(true)
+	}
+	handler(conn)
+	return nil
+}
+
+// 没有Origin头的请求不是浏览器发起的，直接放行
+func checkWebsocketOrigin(r *http.Request, allowOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(allowOrigins) == 0 {
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		return strings.EqualFold(u.Host, r.Host)
+	}
+	for _, pattern := range allowOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断origin是否匹配pattern，pattern支持"*"和"https://*.example.com"
+// 通配符只匹配子域名，不匹配example.com本身
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.EqualFold(pattern, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(pattern, "://*.")
+	if !ok {
+		return false
+	}
+	prefix := scheme + "://"
+	if len(origin) <= len(prefix) || !strings.EqualFold(origin[:len(prefix)], prefix) {
+		return false
+	}
+	sub := origin[len(prefix):]
+	suffix := "." + host
+	return len(sub) > len(suffix) && strings.EqualFold(sub[len(sub)-len(suffix):], suffix)
+}
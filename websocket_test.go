@@ -0,0 +1,144 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckWebsocketOrigin(t *testing.T) {
+	wildcard := []string{"https://*.example.com"}
+	tests := []struct {
+		name   string
+		allow  []string
+		origin string
+		want   bool
+	}{
+		{"same origin by default", nil, "http://api.local:8080", true},
+		{"same origin ignores case", nil, "http://API.local:8080", true},
+		{"cross origin rejected by default", nil, "http://evil.com", false},
+		{"port mismatch rejected", nil, "http://api.local:9090", false},
+		{"missing origin allowed", nil, "", true},
+		{"malformed origin rejected", nil, "://bad", false},
+		{"exact match", []string{"https://app.com"}, "https://app.com", true},
+		{"exact list ignores same origin", []string{"https://app.com"}, "http://api.local:8080", false},
+		{"star allows all", []string{"*"}, "http://evil.com", true},
+		{"wildcard subdomain", wildcard, "https://a.example.com", true},
+		{"wildcard nested subdomain", wildcard, "https://a.b.example.com", true},
+		{"wildcard excludes apex", wildcard, "https://example.com", false},
+		{"wildcard checks scheme", wildcard, "http://a.example.com", false},
+		{"wildcard rejects suffix attack", wildcard, "https://a.example.com.evil.net", false},
+		{"wildcard rejects lookalike", wildcard, "https://aexample.com", false},
+		{"wildcard rejects empty label", wildcard, "https://.example.com", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://api.local:8080/ws", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := checkWebsocketOrigin(req, tt.allow); got != tt.want {
+			t.Errorf("%s: origin %q allow %v = %v, want %v", tt.name, tt.origin, tt.allow, got, tt.want)
+		}
+	}
+}
+
+// 启动一个echo服务，返回ws地址
+func newWebsocketServer(t *testing.T, config WebsocketConfig) string {
+	t.Helper()
+	e := NewEngine()
+	e.SetWebsocketConfig(config)
+	e.GET("/ws", func(ctx *Context) {
+		ctx.Websocket(func(conn *websocket.Conn) {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, msg)
+		})
+	})
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+func dialWebsocket(url, origin string) (*websocket.Conn, int, error) {
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	code := 0
+	if resp != nil {
+		code = resp.StatusCode
+	}
+	return conn, code, err
+}
+
+func TestWebsocketOriginHandshake(t *testing.T) {
+	tests := []struct {
+		name   string
+		config WebsocketConfig
+		origin func(url string) string
+		code   int
+	}{
+		{
+			name:   "same origin",
+			origin: func(url string) string { return "http" + strings.TrimSuffix(strings.TrimPrefix(url, "ws"), "/ws") },
+			code:   http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "cross origin",
+			origin: func(string) string { return "http://evil.com" },
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "no origin",
+			origin: func(string) string { return "" },
+			code:   http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "allow list",
+			config: WebsocketConfig{AllowOrigins: []string{"https://*.example.com"}},
+			origin: func(string) string { return "https://a.example.com" },
+			code:   http.StatusSwitchingProtocols,
+		},
+		{
+			name: "CheckOrigin overrides allow list",
+			config: WebsocketConfig{
+				AllowOrigins: []string{"https://*.example.com"},
+				CheckOrigin:  func(r *http.Request) bool { return r.Header.Get("Origin") == "http://evil.com" },
+			},
+			origin: func(string) string { return "https://a.example.com" },
+			code:   http.StatusForbidden,
+		},
+		{
+			name: "CheckOrigin allows unlisted origin",
+			config: WebsocketConfig{
+				AllowOrigins: []string{"https://*.example.com"},
+				CheckOrigin:  func(r *http.Request) bool { return r.Header.Get("Origin") == "http://evil.com" },
+			},
+			origin: func(string) string { return "http://evil.com" },
+			code:   http.StatusSwitchingProtocols,
+		},
+	}
+	for _, tt := range tests {
+		url := newWebsocketServer(t, tt.config)
+		conn, code, err := dialWebsocket(url, tt.origin(url))
+		if code != tt.code {
+			t.Errorf("%s: handshake status %d, want %d (err %v)", tt.name, code, tt.code, err)
+		}
+		if conn == nil {
+			continue
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+			t.Fatalf("%s: write: %v", tt.name, err)
+		}
+		if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "ping" {
+			t.Errorf("%s: echo %q, %v", tt.name, msg, err)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,379 @@
+package ex
+
+/*
+ * websocket连接管理
+ * 每个连接有独立的写协程，负责发送消息和ping，读协程负责处理pong和消息
+ * 连接可以加入多个房间，按房间广播消息，引擎Shutdown时会关闭所有连接
+ */
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 向已经关闭的连接发送消息时返回
+var ErrWSClosed = errors.New("websocket connection closed")
+
+// 发送缓冲区满时返回，此时连接会被关闭
+var ErrWSSlowConsumer = errors.New("websocket send buffer full")
+
+// WSHub配置
+type WSHubConfig struct {
+	// 升级连接使用的配置，为空时使用引擎的websocket配置
+	Websocket *WebsocketConfig
+	// ping间隔，默认为PongWait的9/10
+	PingInterval time.Duration
+	// 等待pong的超时时间，默认60秒
+	PongWait time.Duration
+	// 单次写入的超时时间，默认10秒
+	WriteWait time.Duration
+	// 每个连接的发送缓冲区大小，默认64
+	SendBuffer int
+	// 连接建立后调用
+	OnConnect func(conn *WSConn)
+	// 收到消息时调用，在连接的读协程中执行
+	OnMessage func(conn *WSConn, messageType int, data []byte)
+	// 连接关闭后调用
+	OnDisconnect func(conn *WSConn)
+}
+
+type wsMessage struct {
+	messageType int
+	data        []byte
+}
+
+// 由WSHub管理的websocket连接
+type WSConn struct {
+	hub  *WSHub
+	ctx  *Context
+	conn *websocket.Conn
+	send chan wsMessage
+
+	closeOnce sync.Once
+	done      chan struct{}
+	closeCode int
+	closeText string
+}
+
+// websocket连接管理器
+type WSHub struct {
+	config WSHubConfig
+
+	mu    sync.RWMutex
+	conns map[*WSConn]map[string]struct{}
+	rooms map[string]map[*WSConn]struct{}
+
+	closed       bool
+	registerOnce sync.Once
+}
+
+// 创建一个websocket连接管理器
+func NewWSHub(config WSHubConfig) *WSHub {
+	if config.PongWait <= 0 {
+		config.PongWait = 60 * time.Second
+	}
+	if config.PingInterval <= 0 || config.PingInterval >= config.PongWait {
+		config.PingInterval = config.PongWait * 9 / 10
+	}
+	if config.WriteWait <= 0 {
+		config.WriteWait = 10 * time.Second
+	}
+	if config.SendBuffer <= 0 {
+		config.SendBuffer = 64
+	}
+	return &WSHub{
+		config: config,
+		conns:  make(map[*WSConn]map[string]struct{}),
+		rooms:  make(map[string]map[*WSConn]struct{}),
+	}
+}
+
+// 升级当前请求并由hub管理连接，会一直阻塞直到连接关闭
+func (h *WSHub) Serve(ctx *Context) error {
+	if ctx.engine != nil {
+		h.registerOnce.Do(func() {
+			ctx.engine.RegisterOnShutdown(h.Close)
+		})
+	}
+
+	handler := func(conn *websocket.Conn) {
+		h.serveConn(ctx, conn)
+	}
+	if h.config.Websocket != nil {
+		return ctx.WebsocketWithOptions(*h.config.Websocket, handler)
+	}
+	return ctx.Websocket(handler)
+}
+
+func (h *WSHub) serveConn(ctx *Context, conn *websocket.Conn) {
+	c := &WSConn{
+		hub:       h,
+		ctx:       ctx,
+		conn:      conn,
+		send:      make(chan wsMessage, h.config.SendBuffer),
+		done:      make(chan struct{}),
+		closeCode: websocket.CloseNormalClosure,
+	}
+	if !h.add(c) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(h.config.WriteWait))
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.writePump()
+	}()
+
+	if h.config.OnConnect != nil {
+		h.config.OnConnect(c)
+	}
+	c.readPump()
+
+	c.closeWith(websocket.CloseNormalClosure, "")
+	wg.Wait()
+	h.remove(c)
+	if h.config.OnDisconnect != nil {
+		h.config.OnDisconnect(c)
+	}
+}
+
+func (c *WSConn) readPump() {
+	pongWait := c.hub.config.PongWait
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if c.hub.config.OnMessage != nil {
+			c.hub.config.OnMessage(c, messageType, data)
+		}
+	}
+}
+
+// 只有写协程会写连接，避免并发写
+func (c *WSConn) writePump() {
+	writeWait := c.hub.config.WriteWait
+	ticker := time.NewTicker(c.hub.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+				c.closeWith(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.closeWith(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(c.closeCode, c.closeText),
+				time.Now().Add(writeWait))
+			return
+		}
+	}
+}
+
+// 发送一条消息，消息先放入发送缓冲区，缓冲区满时关闭连接
+func (c *WSConn) Send(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrWSClosed
+	default:
+	}
+	select {
+	case c.send <- wsMessage{messageType: messageType, data: data}:
+		return nil
+	case <-c.done:
+		return ErrWSClosed
+	default:
+		c.closeWith(websocket.ClosePolicyViolation, "send buffer full")
+		return ErrWSSlowConsumer
+	}
+}
+
+// 发送文本消息
+func (c *WSConn) SendText(text string) error {
+	return c.Send(websocket.TextMessage, []byte(text))
+}
+
+// 把v编码为json后以文本消息发送
+func (c *WSConn) SendJSON(v any) error {
+	b, err := c.ctx.JSONCodec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(websocket.TextMessage, b)
+}
+
+// 加入房间
+func (c *WSConn) Join(room string) {
+	c.hub.join(c, room)
+}
+
+// 离开房间
+func (c *WSConn) Leave(room string) {
+	c.hub.leave(c, room)
+}
+
+// 连接当前加入的房间
+func (c *WSConn) Rooms() []string {
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	rooms := make([]string, 0, len(c.hub.conns[c]))
+	for room := range c.hub.conns[c] {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// 建立连接时的请求上下文
+func (c *WSConn) Context() *Context {
+	return c.ctx
+}
+
+// 底层的websocket连接，不要在写协程之外直接写入
+func (c *WSConn) Conn() *websocket.Conn {
+	return c.conn
+}
+
+// 连接关闭时会被关闭，可以用于select
+func (c *WSConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// 发送关闭帧并关闭连接
+func (c *WSConn) Close() {
+	c.closeWith(websocket.CloseNormalClosure, "")
+}
+
+func (c *WSConn) closeWith(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+		// 让阻塞在ReadMessage中的读协程尽快退出
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.config.WriteWait))
+	})
+}
+
+// 向房间内的所有连接广播文本消息
+func (h *WSHub) Broadcast(room string, msg []byte) {
+	h.BroadcastMessage(room, websocket.TextMessage, msg)
+}
+
+// 向房间内的所有连接广播消息，room为空时广播给所有连接
+func (h *WSHub) BroadcastMessage(room string, messageType int, data []byte) {
+	h.mu.RLock()
+	var targets []*WSConn
+	if room == "" {
+		targets = make([]*WSConn, 0, len(h.conns))
+		for c := range h.conns {
+			targets = append(targets, c)
+		}
+	} else {
+		targets = make([]*WSConn, 0, len(h.rooms[room]))
+		for c := range h.rooms[room] {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		c.Send(messageType, data)
+	}
+}
+
+// 房间内的连接数，room为空时返回全部连接数
+func (h *WSHub) Count(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if room == "" {
+		return len(h.conns)
+	}
+	return len(h.rooms[room])
+}
+
+// 关闭所有连接，之后新的连接会被立即关闭
+func (h *WSHub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	conns := make([]*WSConn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		c.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+func (h *WSHub) add(c *WSConn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.conns[c] = make(map[string]struct{})
+	return true
+}
+
+func (h *WSHub) remove(c *WSConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for room := range h.conns[c] {
+		h.deleteFromRoom(c, room)
+	}
+	delete(h.conns, c)
+}
+
+func (h *WSHub) join(c *WSConn, room string) {
+	if room == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rooms, ok := h.conns[c]
+	if !ok {
+		return
+	}
+	rooms[room] = struct{}{}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*WSConn]struct{})
+	}
+	h.rooms[room][c] = struct{}{}
+}
+
+func (h *WSHub) leave(c *WSConn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if rooms, ok := h.conns[c]; ok {
+		delete(rooms, room)
+	}
+	h.deleteFromRoom(c, room)
+}
+
+func (h *WSHub) deleteFromRoom(c *WSConn, room string) {
+	delete(h.rooms[room], c)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
@@ -0,0 +1,278 @@
+package ex
+
+/*
+ * websocket消息路由
+ * 消息格式为{"event": "...", "data": ..., "id": ...}，按event分发给注册的处理函数
+ * 带id的消息处理完后会回复相同id的消息，客户端可以用来关联请求和响应
+ */
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocket消息信封
+type WSEnvelope struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	ID    json.RawMessage `json:"id,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// websocket消息处理函数，也用作消息中间件
+type WSHandlerFunc func(*WSContext)
+
+// 一条消息的处理上下文
+type WSContext struct {
+	Conn  *WSConn
+	Event string
+	// 消息id，原样回传给客户端
+	ID   json.RawMessage
+	Data json.RawMessage
+
+	handlers []WSHandlerFunc
+	index    int
+	replied  bool
+	err      error
+}
+
+func (c *WSContext) Next() {
+	c.index++
+	for c.index < len(c.handlers) {
+		c.handlers[c.index](c)
+		c.index++
+	}
+}
+
+func (c *WSContext) Abort() {
+	c.index = len(c.handlers)
+}
+
+// 终止处理并回复错误
+func (c *WSContext) AbortWithError(err error) {
+	c.err = err
+	c.Abort()
+}
+
+// 建立连接时的请求上下文
+func (c *WSContext) Context() *Context {
+	return c.Conn.Context()
+}
+
+// 把消息数据解析到v
+func (c *WSContext) Bind(v any) error {
+	if len(c.Data) == 0 {
+		return nil
+	}
+	return c.Context().JSONCodec().Unmarshal(c.Data, v)
+}
+
+// 回复当前消息，只有第一次回复有效
+func (c *WSContext) Reply(data any) error {
+	if c.replied {
+		return nil
+	}
+	c.replied = true
+	raw, err := c.marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.send(WSEnvelope{Event: c.Event, ID: c.ID, Data: raw})
+}
+
+// 向客户端推送一个事件
+func (c *WSContext) Emit(event string, data any) error {
+	raw, err := c.marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.send(WSEnvelope{Event: event, Data: raw})
+}
+
+func (c *WSContext) replyError(err error) {
+	if c.replied {
+		return
+	}
+	c.replied = true
+	c.send(WSEnvelope{Event: c.Event, ID: c.ID, Error: err.Error()})
+}
+
+func (c *WSContext) marshal(data any) (json.RawMessage, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return c.Context().JSONCodec().Marshal(data)
+}
+
+func (c *WSContext) send(env WSEnvelope) error {
+	b, err := c.Context().JSONCodec().Marshal(env)
+	if err != nil {
+		return err
+	}
+	return c.Conn.Send(websocket.TextMessage, b)
+}
+
+var (
+	wsContextType = reflect.TypeOf((*WSContext)(nil))
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// websocket消息路由
+type WSRouter struct {
+	mu          sync.RWMutex
+	routes      map[string][]WSHandlerFunc
+	middlewares []WSHandlerFunc
+
+	hubOnce sync.Once
+	hub     *WSHub
+}
+
+// 创建一个websocket消息路由
+func NewWSRouter() *WSRouter {
+	return &WSRouter{
+		routes: make(map[string][]WSHandlerFunc),
+	}
+}
+
+// 注册对所有事件生效的中间件，只影响之后注册的事件
+func (r *WSRouter) Use(middlewares ...WSHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+/*
+- 注册事件处理函数，handler支持以下几种形式，T为消息数据的类型:
+
+	func(c *ex.WSContext) error
+	func(c *ex.WSContext, payload T) error
+	func(c *ex.WSContext) (R, error)
+	func(c *ex.WSContext, payload T) (R, error)
+
+- 返回R时会作为回复的数据，返回错误时回复错误信息，middlewares只对这个事件生效
+*/
+func (r *WSRouter) On(event string, handler any, middlewares ...WSHandlerFunc) {
+	r.handle(event, wrapWSHandler(handler), middlewares)
+}
+
+// 注册带类型的事件处理函数，和On相同但在编译期检查handler的签名，不使用反射
+// 需要回复数据时在h中调用c.Reply
+func OnEvent[T any](r *WSRouter, event string, h func(*WSContext, T) error, middlewares ...WSHandlerFunc) {
+	r.handle(event, func(c *WSContext) {
+		var payload T
+		if err := c.Bind(&payload); err != nil {
+			c.err = err
+			return
+		}
+		if err := h(c, payload); err != nil {
+			c.err = err
+		}
+	}, middlewares)
+}
+
+func (r *WSRouter) handle(event string, final WSHandlerFunc, middlewares []WSHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	handlers := make([]WSHandlerFunc, 0, len(r.middlewares)+len(middlewares)+1)
+	handlers = append(handlers, r.middlewares...)
+	handlers = append(handlers, middlewares...)
+	handlers = append(handlers, final)
+	r.routes[event] = handlers
+}
+
+// 通过反射把用户的处理函数包装成WSHandlerFunc
+func wrapWSHandler(handler any) WSHandlerFunc {
+	fn := reflect.ValueOf(handler)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() < 1 || t.NumIn() > 2 || t.In(0) != wsContextType {
+		panic(fmt.Sprintf("ex: invalid websocket handler %T", handler))
+	}
+	if t.NumOut() < 1 || t.NumOut() > 2 || t.Out(t.NumOut()-1) != errorType {
+		panic(fmt.Sprintf("ex: websocket handler %T must return error", handler))
+	}
+
+	var payloadType reflect.Type
+	if t.NumIn() == 2 {
+		payloadType = t.In(1)
+	}
+
+	return func(c *WSContext) {
+		args := []reflect.Value{reflect.ValueOf(c)}
+		if payloadType != nil {
+			payload, err := decodeWSPayload(c, payloadType)
+			if err != nil {
+				c.err = err
+				return
+			}
+			args = append(args, payload)
+		}
+
+		out := fn.Call(args)
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			c.err = err
+			return
+		}
+		if len(out) == 2 {
+			c.Reply(out[0].Interface())
+		}
+	}
+}
+
+func decodeWSPayload(c *WSContext, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Pointer {
+		v := reflect.New(t.Elem())
+		if err := c.Bind(v.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+		return v, nil
+	}
+	v := reflect.New(t)
+	if err := c.Bind(v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// 处理一条消息，可以直接作为WSHubConfig.OnMessage使用
+func (r *WSRouter) HandleMessage(conn *WSConn, messageType int, data []byte) {
+	c := &WSContext{Conn: conn, index: -1}
+
+	var env WSEnvelope
+	if err := conn.Context().JSONCodec().Unmarshal(data, &env); err != nil || env.Event == "" {
+		c.replyError(errors.New("invalid message"))
+		return
+	}
+	c.Event, c.ID, c.Data = env.Event, env.ID, env.Data
+
+	r.mu.RLock()
+	handlers, ok := r.routes[env.Event]
+	r.mu.RUnlock()
+	if !ok {
+		c.replyError(fmt.Errorf("unknown event %q", env.Event))
+		return
+	}
+
+	c.handlers = handlers
+	c.Next()
+	if c.err != nil {
+		c.replyError(c.err)
+		return
+	}
+	// 带id的消息即使处理函数没有回复也要确认
+	if len(c.ID) > 0 {
+		c.Reply(nil)
+	}
+}
+
+// 升级当前请求并按事件分发消息，会一直阻塞直到连接关闭
+// 需要房间，广播或者自定义保活参数时，请把HandleMessage设置到自己的WSHub上
+func (r *WSRouter) Serve(ctx *Context) error {
+	r.hubOnce.Do(func() {
+		r.hub = NewWSHub(WSHubConfig{OnMessage: r.HandleMessage})
+	})
+	return r.hub.Serve(ctx)
+}
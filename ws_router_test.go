@@ -0,0 +1,131 @@
+package ex
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type wsEcho struct {
+	Text string `json:"text"`
+}
+
+// 启动使用r分发消息的服务并建立连接
+func dialWSRouter(t *testing.T, r *WSRouter) *websocket.Conn {
+	t.Helper()
+	e := NewEngine()
+	e.GET("/ws", func(ctx *Context) { r.Serve(ctx) })
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// 发送一条原始消息并读取回复
+func wsRoundTrip(t *testing.T, conn *websocket.Conn, msg string) WSEnvelope {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var env WSEnvelope
+	if err := conn.ReadJSON(&env); err != nil {
+		t.Fatalf("read reply to %s: %v", msg, err)
+	}
+	return env
+}
+
+func TestWSRouterDispatch(t *testing.T) {
+	var secretCalls atomic.Int32
+	r := NewWSRouter()
+	r.Use(func(c *WSContext) {
+		if c.Event == "admin.secret" {
+			c.AbortWithError(errors.New("forbidden"))
+			return
+		}
+		c.Next()
+	})
+	r.On("echo", func(c *WSContext, msg wsEcho) (wsEcho, error) {
+		return msg, nil
+	})
+	r.On("fail", func(c *WSContext) error {
+		return errors.New("boom")
+	})
+	r.On("silent", func(c *WSContext) error { return nil })
+	r.On("admin.secret", func(c *WSContext) error {
+		secretCalls.Add(1)
+		return nil
+	})
+	OnEvent(r, "upper", func(c *WSContext, msg wsEcho) error {
+		return c.Reply(wsEcho{Text: strings.ToUpper(msg.Text)})
+	})
+	OnEvent(r, "count", func(c *WSContext, n int) error {
+		return c.Reply(n + 1)
+	})
+	conn := dialWSRouter(t, r)
+
+	tests := []struct {
+		name string
+		msg  string
+		want WSEnvelope
+	}{
+		{"dispatch by event", `{"event":"echo","id":1,"data":{"text":"hi"}}`,
+			WSEnvelope{Event: "echo", ID: []byte(`1`), Data: []byte(`{"text":"hi"}`)}},
+		{"string id echoed", `{"event":"echo","id":"req-7","data":{"text":"yo"}}`,
+			WSEnvelope{Event: "echo", ID: []byte(`"req-7"`), Data: []byte(`{"text":"yo"}`)}},
+		{"typed OnEvent", `{"event":"upper","id":2,"data":{"text":"hi"}}`,
+			WSEnvelope{Event: "upper", ID: []byte(`2`), Data: []byte(`{"text":"HI"}`)}},
+		{"typed OnEvent scalar", `{"event":"count","id":3,"data":41}`,
+			WSEnvelope{Event: "count", ID: []byte(`3`), Data: []byte(`42`)}},
+		{"ack without reply", `{"event":"silent","id":4}`,
+			WSEnvelope{Event: "silent", ID: []byte(`4`)}},
+		{"handler error", `{"event":"fail","id":5}`,
+			WSEnvelope{Event: "fail", ID: []byte(`5`), Error: "boom"}},
+		{"unknown event", `{"event":"nope","id":6}`,
+			WSEnvelope{Event: "nope", ID: []byte(`6`), Error: `unknown event "nope"`}},
+		{"invalid json", `{"event":`,
+			WSEnvelope{Error: "invalid message"}},
+		{"missing event", `{"id":7}`,
+			WSEnvelope{Error: "invalid message"}},
+		{"payload type mismatch", `{"event":"count","id":8,"data":"x"}`,
+			WSEnvelope{Event: "count", ID: []byte(`8`), Error: "json: cannot unmarshal string into Go value of type int"}},
+		{"middleware abort", `{"event":"admin.secret","id":9}`,
+			WSEnvelope{Event: "admin.secret", ID: []byte(`9`), Error: "forbidden"}},
+	}
+	for _, tt := range tests {
+		got := wsRoundTrip(t, conn, tt.msg)
+		if got.Event != tt.want.Event || string(got.ID) != string(tt.want.ID) ||
+			string(got.Data) != string(tt.want.Data) || got.Error != tt.want.Error {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if n := secretCalls.Load(); n != 0 {
+		t.Errorf("aborted handler ran %d times", n)
+	}
+}
+
+func TestWSRouterNoAckWithoutID(t *testing.T) {
+	r := NewWSRouter()
+	r.On("silent", func(c *WSContext) error { return nil })
+	r.On("ping", func(c *WSContext) (string, error) { return "pong", nil })
+	conn := dialWSRouter(t, r)
+
+	// 不带id且没有回复的消息不会收到任何响应，下一条读到的应该是ping的回复
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"silent"}`)); err != nil {
+		t.Fatal(err)
+	}
+	got := wsRoundTrip(t, conn, `{"event":"ping"}`)
+	if got.Event != "ping" || string(got.Data) != `"pong"` {
+		t.Errorf("got %+v", got)
+	}
+}